@@ -0,0 +1,41 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+/*
+ * Compares generateKeyPairsParallel with generating the same number of key
+ * pairs one after another on the main thread.
+ *
+ *   node bench/keygen_parallel.js [count] [workers] [rounds]
+ */
+
+const curve = require('../src/curve');
+const keyhelper = require('../src/keyhelper');
+
+const count = Number(process.argv[2]) || 2000;
+const workers = Number(process.argv[3]) || 4;
+const rounds = Number(process.argv[4]) || 5;
+
+async function time(fn) {
+    await fn();  // warm up
+    const start = process.hrtime.bigint();
+    for (let i = 0; i < rounds; i++) {
+        await fn();
+    }
+    return Number(process.hrtime.bigint() - start) / 1e6 / rounds;
+}
+
+async function main() {
+    const sequential = await time(() => {
+        for (let i = 0; i < count; i++) {
+            curve.generateKeyPair();
+        }
+    });
+    const parallel = await time(() => keyhelper.generateKeyPairsParallel(count, workers));
+    console.log(`${count} key pairs, mean of ${rounds} rounds`);
+    console.log(`sequential:   ${sequential.toFixed(2)} ms`);
+    console.log(`${`${workers} workers:`.padEnd(13)} ${parallel.toFixed(2)} ms` +
+                ` (${(sequential / parallel).toFixed(2)}x speedup)`);
+}
+
+main();
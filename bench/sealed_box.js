@@ -0,0 +1,34 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+/*
+ * Compares sealManyToPublicKey with one sealToPublicKey call per payload.
+ *
+ *   node bench/sealed_box.js [payloads] [rounds]
+ */
+
+const curve = require('../src/curve');
+const nodeCrypto = require('crypto');
+const sealedBox = require('../src/sealed_box');
+
+const payloads = Number(process.argv[2]) || 100;
+const rounds = Number(process.argv[3]) || 20;
+
+const recipient = curve.generateKeyPair();
+const plaintexts = Array.from({length: payloads}, () => nodeCrypto.randomBytes(256));
+
+function time(fn) {
+    fn();  // warm up
+    const start = process.hrtime.bigint();
+    for (let i = 0; i < rounds; i++) {
+        fn();
+    }
+    return Number(process.hrtime.bigint() - start) / 1e6 / rounds;
+}
+
+const single = time(() => plaintexts.map(x => sealedBox.sealToPublicKey(recipient.pubKey, x)));
+const batch = time(() => sealedBox.sealManyToPublicKey(recipient.pubKey, plaintexts));
+console.log(`${payloads} payloads, mean of ${rounds} rounds`);
+console.log(`sealToPublicKey x ${payloads}: ${single.toFixed(2)} ms`);
+console.log(`sealManyToPublicKey:      ${batch.toFixed(2)} ms`);
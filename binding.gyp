@@ -8,6 +8,7 @@
       "./native/ed25519/additions/compare.c",
       "./native/ed25519/additions/curve_sigs.c",
       "./native/ed25519/additions/sign_modified.c",
+      "./native/ed25519/additions/xeddsa.c",
       "./native/ed25519/fe_0.c",
       "./native/ed25519/fe_1.c",
       "./native/ed25519/fe_add.c",
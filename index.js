@@ -1,10 +1,38 @@
 'use strict';
 
+exports.attestation = require('./src/attestation');
+exports.blinding = require('./src/blinding');
 exports.crypto = require('./src/crypto');
 exports.curve = require('./src/curve');
+exports.derivedKeys = require('./src/derived_keys');
+exports.deviceName = require('./src/device_name');
+exports.disappearingTimer = require('./src/disappearing_timer');
+exports.envelope = require('./src/envelope');
+exports.fingerprint = require('./src/numeric_fingerprint');
+exports.groups = require('./src/groups');
+exports.identicon = require('./src/identicon');
+exports.identityRecord = require('./src/identity_record');
+exports.insecureTestFixtures = require('./src/insecure_test_fixtures');
 exports.keyhelper = require('./src/keyhelper');
+exports.linkToken = require('./src/link_token');
+exports.pinRecovery = require('./src/pin_recovery');
+exports.preKeyBundle = require('./src/prekey_bundle');
 exports.ProtocolAddress = require('./src/protocol_address');
+exports.quote = require('./src/quote');
+exports.readReceipts = require('./src/read_receipts');
+exports.sealedBox = require('./src/sealed_box');
+exports.senderKey = require('./src/sender_key');
 exports.SessionBuilder = require('./src/session_builder');
 exports.SessionCipher = require('./src/session_cipher');
 exports.SessionRecord = require('./src/session_record');
+exports.signedMessage = require('./src/signed_message');
+exports.x3dh = require('./src/x3dh');
 Object.assign(exports, require('./src/errors'));
+
+// The native self check only runs on request; without it healthy stays true.
+exports.healthy = process.env.LIBSIGNAL_SELF_CHECK ?
+    require('./src/self_check').isHealthy() : true;
+
+if (process.env.LIBSIGNAL_DEBUG) {
+    exports.debug = require('./src/debug');
+}
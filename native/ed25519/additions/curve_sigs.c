@@ -3,6 +3,7 @@
 #include "ge.h"
 #include "curve_sigs.h"
 #include "crypto_sign.h"
+#include "zeroize.h"
 
 void curve25519_keygen(unsigned char* curve25519_pubkey_out,
                        unsigned char* curve25519_privkey_in)
@@ -57,7 +58,8 @@ void curve25519_sign(unsigned char* signature_out,
   /* Encode the sign bit into signature (in unused high bit of S) */
   signature_out[63] &= 0x7F; /* bit should be zero already, but just in case */
   signature_out[63] |= sign_bit;
-  
+
+  zeroize(ed_keypair, 64); /* the private key is copied into it */
   free(sigbuf);
 }
 
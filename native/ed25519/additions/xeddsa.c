@@ -0,0 +1,90 @@
+#include <string.h>
+#include <stdlib.h>
+#include "ge.h"
+#include "sc.h"
+#include "crypto_hash_sha512.h"
+#include "xeddsa.h"
+#include "zeroize.h"
+
+/* L - 1, little endian */
+static const unsigned char lminus1[32] = {
+  0xec, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58,
+  0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+  0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+  0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10
+};
+
+/* out = -a mod L, computed as (L - 1) * a + 0 */
+static void sc_neg(unsigned char* out, const unsigned char* a)
+{
+  unsigned char zero[32];
+  memset(zero, 0, 32);
+  sc_muladd(out, lminus1, a, zero);
+}
+
+/* Replaces f with g when b is 1, leaves it alone when b is 0, without
+   branching on b. */
+static void sc_cmov(unsigned char* f, const unsigned char* g, unsigned char b)
+{
+  unsigned char mask = (unsigned char)(-(int)b);
+  int i;
+  for (i = 0; i < 32; i++)
+    f[i] ^= mask & (f[i] ^ g[i]);
+}
+
+int xeddsa_sign(unsigned char* signature_out,
+                const unsigned char* curve25519_privkey,
+                const unsigned char* msg, unsigned long msg_len,
+                const unsigned char* random)
+{
+  ge_p3 point;
+  unsigned char a[32], aneg[32];
+  unsigned char A[32];
+  unsigned char nonce[64];
+  unsigned char hram[64];
+  unsigned char sign_bit;
+  unsigned char* buf;
+  int i;
+
+  buf = (unsigned char*)malloc(msg_len + 128);
+  if (buf == NULL)
+    return -1;
+
+  /* A = aB.  XEdDSA fixes the sign bit of A to zero, so when it is set
+     negate a, which flips A to the point with the sign bit clear. */
+  ge_scalarmult_base(&point, curve25519_privkey);
+  ge_p3_tobytes(A, &point);
+  sign_bit = A[31] >> 7;
+  memmove(a, curve25519_privkey, 32);
+  sc_neg(aneg, a);
+  sc_cmov(a, aneg, sign_bit);
+  A[31] &= 0x7F;
+
+  /* r = hash1(a || M || Z) mod L, where hash1 prefixes 0xFE followed by
+     31 bytes of 0xFF */
+  buf[0] = 0xFE;
+  for (i = 1; i < 32; i++)
+    buf[i] = 0xFF;
+  memmove(buf + 32, a, 32);
+  memmove(buf + 64, msg, msg_len);
+  memmove(buf + 64 + msg_len, random, 64);
+  crypto_hash_sha512(nonce, buf, msg_len + 128);
+  sc_reduce(nonce);
+
+  /* R = rB, h = hash(R || A || M) mod L, s = r + ha mod L */
+  ge_scalarmult_base(&point, nonce);
+  ge_p3_tobytes(buf, &point);
+  memmove(buf + 32, A, 32);
+  crypto_hash_sha512(hram, buf, msg_len + 64);
+  sc_reduce(hram);
+
+  memmove(signature_out, buf, 32);
+  sc_muladd(signature_out + 32, hram, a, nonce);
+
+  zeroize(a, 32);
+  zeroize(aneg, 32);
+  zeroize(nonce, 64);
+  zeroize(buf, msg_len + 128);
+  free(buf);
+  return 0;
+}
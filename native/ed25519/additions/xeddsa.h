@@ -0,0 +1,21 @@
+
+#ifndef __XEDDSA_H__
+#define __XEDDSA_H__
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* XEdDSA signature over a Curve25519 private key (clamped), using 64 bytes
+   of caller supplied randomness.  The signature verifies with
+   curve25519_verify(). */
+int xeddsa_sign(unsigned char* signature_out,
+                const unsigned char* curve25519_privkey,
+                const unsigned char* msg, unsigned long msg_len,
+                const unsigned char* random);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,29 @@
+
+#ifndef __ZEROIZE_H__
+#define __ZEROIZE_H__
+
+#include <stddef.h>
+
+/* Clears secret buffers.  Writing through a volatile pointer stops the
+   compiler from dropping the stores as dead, which it may do to a plain
+   memset just before the buffer goes out of scope. */
+#ifdef ZEROIZE_TEST_HOOK
+/* Test builds only: called after every wipe so a test can check that the
+   buffer really is zero (see test/native/zeroize_test.c). */
+void ZEROIZE_TEST_HOOK(const void* v, size_t n);
+#endif
+
+static inline void zeroize(void* v, size_t n)
+{
+  volatile unsigned char* p = (volatile unsigned char*)v;
+#ifdef ZEROIZE_TEST_HOOK
+  size_t len = n;
+#endif
+  while (n--)
+    *p++ = 0;
+#ifdef ZEROIZE_TEST_HOOK
+  ZEROIZE_TEST_HOOK(v, len);
+#endif
+}
+
+#endif
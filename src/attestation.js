@@ -0,0 +1,359 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const curve = require('./curve');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+const CAPABILITIES_LABEL = 'LibSignalCapabilities';
+const AUTH_CHALLENGE_LABEL = 'LibSignalAuthChallenge';
+const SYNC_TOKEN_LABEL = 'LibSignalSyncToken';
+const PRESENCE_TOKEN_LABEL = 'LibSignalPresenceToken';
+const UPLOAD_COMMITMENT_LABEL = 'LibSignalPrekeyUploadCommitment';
+const MAX_PRESENCE_TTL_SECONDS = 24 * 60 * 60;
+
+
+function assertBufferArray(value, name) {
+    if (!Array.isArray(value) || !value.every(x => x instanceof Buffer)) {
+        throw new TypeError(`${name} must be an array of Buffers`);
+    }
+}
+
+/*
+ * Both sides serialize the batch as uint32 BE length || key for each prekey,
+ * in the given order, so a swapped, dropped or altered key breaks the signature.
+ */
+function encodePreKeyBatch(preKeys) {
+    assertBufferArray(preKeys, 'preKeys');
+    const parts = [];
+    for (const preKey of preKeys) {
+        const length = Buffer.alloc(4);
+        length.writeUInt32BE(preKey.byteLength);
+        parts.push(length, preKey);
+    }
+    return Buffer.concat(parts);
+}
+
+
+function signAggregatePreKeys(identityPrivKey, preKeys) {
+    return curve.calculateSignature(identityPrivKey, encodePreKeyBatch(preKeys));
+}
+
+
+function verifyAggregatePreKeySignature(identityPubKey, preKeys, signature) {
+    return curve.verifySignature(identityPubKey, encodePreKeyBatch(preKeys), signature);
+}
+
+function canonicalCapabilities(capabilities) {
+    if (!Array.isArray(capabilities) ||
+        !capabilities.every(x => typeof x === 'string' && x.length)) {
+        throw new TypeError('capabilities must be an array of non-empty strings');
+    }
+    return Array.from(new Set(capabilities)).sort();
+}
+
+/*
+ * The signed payload is the label followed by uint32 BE length || UTF-8 name for
+ * each capability after sorting and removing duplicates, so any ordering of the
+ * same set produces the same attestation.
+ */
+function encodeCapabilities(capabilities) {
+    const parts = [Buffer.from(CAPABILITIES_LABEL)];
+    for (const capability of capabilities) {
+        const name = Buffer.from(capability, 'utf8');
+        const length = Buffer.alloc(4);
+        length.writeUInt32BE(name.byteLength);
+        parts.push(length, name);
+    }
+    return Buffer.concat(parts);
+}
+
+
+function signCapabilities(identityPrivKey, capabilities) {
+    const canonical = canonicalCapabilities(capabilities);
+    return {
+        capabilities: canonical,
+        signature: curve.calculateSignature(identityPrivKey, encodeCapabilities(canonical))
+    };
+}
+
+
+function verifyCapabilities(identityPubKey, capabilities, signature) {
+    const canonical = canonicalCapabilities(capabilities);
+    if (!curve.verifySignature(identityPubKey, encodeCapabilities(canonical), signature)) {
+        throw new errors.SignatureError('Invalid capabilities signature');
+    }
+    return canonical;
+}
+
+/*
+ * Timestamped statements are signed as label || uint64 BE timestamp || payload.
+ * The label keeps a signature made for one purpose from being accepted for
+ * another; timestamps are milliseconds since the epoch.
+ */
+function encodeTimestamped(label, timestamp, payload) {
+    if (!Number.isSafeInteger(timestamp) || timestamp < 0) {
+        throw new RangeError('Invalid timestamp: ' + timestamp);
+    }
+    if (!(payload instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${payload?.constructor?.name}`);
+    }
+    const time = Buffer.alloc(8);
+    time.writeBigUInt64BE(BigInt(timestamp));
+    return Buffer.concat([Buffer.from(label), time, payload]);
+}
+
+function isFresh(timestamp, maxAgeSeconds, now = Date.now()) {
+    if (!Number.isSafeInteger(maxAgeSeconds) || maxAgeSeconds < 0) {
+        throw new RangeError('Invalid maxAgeSeconds: ' + maxAgeSeconds);
+    }
+    // Clock skew cuts both ways, so the same window applies to the future.
+    return Math.abs(now - timestamp) <= maxAgeSeconds * 1000;
+}
+
+
+/*
+ * Checks a decrypted message's send timestamp against when it arrived (both ms
+ * since the epoch).  Returns { valid, reason } where reason is 'too_old' or
+ * 'too_far_in_future' when outside the tolerance, and null otherwise.
+ */
+function validateMessageTimestamp(messageTimestamp, receivedAt, toleranceMillis) {
+    for (const [name, value] of [['messageTimestamp', messageTimestamp],
+                                 ['receivedAt', receivedAt],
+                                 ['toleranceMillis', toleranceMillis]]) {
+        if (!Number.isSafeInteger(value) || value < 0) {
+            throw new RangeError(`Invalid ${name}: ${value}`);
+        }
+    }
+    if (receivedAt - messageTimestamp > toleranceMillis) {
+        return {valid: false, reason: 'too_old'};
+    }
+    if (messageTimestamp - receivedAt > toleranceMillis) {
+        return {valid: false, reason: 'too_far_in_future'};
+    }
+    return {valid: true, reason: null};
+}
+
+
+function signAuthChallenge(identityPrivKey, nonce, timestamp = Date.now()) {
+    return {
+        signature: curve.calculateSignature(identityPrivKey,
+                                            encodeTimestamped(AUTH_CHALLENGE_LABEL, timestamp, nonce)),
+        timestamp
+    };
+}
+
+
+function verifyAuthChallenge(identityPubKey, nonce, signature, timestamp, maxAgeSeconds) {
+    const message = encodeTimestamped(AUTH_CHALLENGE_LABEL, timestamp, nonce);
+    if (!isFresh(timestamp, maxAgeSeconds)) {
+        return false;
+    }
+    return curve.verifySignature(identityPubKey, message, signature);
+}
+
+/*
+ * Read position tokens between a user's own devices: the signature covers the
+ * conversation id and the time the position was recorded.
+ */
+function signSyncToken(identityPrivKey, conversationId, timestamp = Date.now()) {
+    return {
+        signature: curve.calculateSignature(identityPrivKey,
+                                            encodeTimestamped(SYNC_TOKEN_LABEL, timestamp, conversationId)),
+        timestamp
+    };
+}
+
+
+function verifySyncToken(identityPubKey, conversationId, signature, timestamp, maxAgeSeconds) {
+    const message = encodeTimestamped(SYNC_TOKEN_LABEL, timestamp, conversationId);
+    if (!isFresh(timestamp, maxAgeSeconds)) {
+        return false;
+    }
+    return curve.verifySignature(identityPubKey, message, signature);
+}
+
+/*
+ * Commitment to a prekey upload, bound to a server supplied nonce:
+ *
+ *   commitment = SHA-256(label || uint32 BE nonce length || nonce ||
+ *                        encodePreKeyBatch(prekeys sorted bytewise))
+ *
+ * Sorting means the server can recompute it from the uploaded keys whatever
+ * order they arrive in.  The identity key signs the commitment.
+ */
+function prekeyUploadCommitment(preKeys, nonce) {
+    assertBufferArray(preKeys, 'preKeys');
+    if (!(nonce instanceof Buffer) || nonce.byteLength < 16) {
+        throw new TypeError('Nonce must be a Buffer of at least 16 bytes');
+    }
+    const nonceLength = Buffer.alloc(4);
+    nonceLength.writeUInt32BE(nonce.byteLength);
+    return nodeCrypto.createHash('sha256')
+        .update(Buffer.from(UPLOAD_COMMITMENT_LABEL))
+        .update(nonceLength)
+        .update(nonce)
+        .update(encodePreKeyBatch(preKeys.slice().sort(Buffer.compare)))
+        .digest();
+}
+
+function commitPrekeyUpload(identityPrivKey, preKeys, nonce) {
+    const commitment = prekeyUploadCommitment(preKeys, nonce);
+    return {
+        commitment,
+        signature: curve.calculateSignature(identityPrivKey, commitment)
+    };
+}
+
+function verifyPrekeyUploadCommitment(identityPubKey, preKeys, nonce, commitment, signature) {
+    const expected = prekeyUploadCommitment(preKeys, nonce);
+    if (!(commitment instanceof Buffer) || commitment.byteLength !== expected.byteLength ||
+        !nodeCrypto.timingSafeEqual(commitment, expected)) {
+        return false;
+    }
+    return curve.verifySignature(identityPubKey, commitment, signature);
+}
+
+
+/*
+ * Presence tokens: a random 16 byte token signed together with its expiry
+ * (ms since the epoch), so it can't be replayed once expired or given a
+ * later expiry.
+ */
+function signPresenceToken(identityPrivKey, ttlSeconds, now = Date.now()) {
+    if (!Number.isInteger(ttlSeconds) || ttlSeconds < 1 || ttlSeconds > MAX_PRESENCE_TTL_SECONDS) {
+        throw new RangeError('Invalid ttlSeconds: ' + ttlSeconds);
+    }
+    const token = nodeCrypto.randomBytes(16);
+    const expiresAt = now + ttlSeconds * 1000;
+    return {
+        token,
+        expiresAt,
+        signature: curve.calculateSignature(identityPrivKey,
+                                            encodeTimestamped(PRESENCE_TOKEN_LABEL, expiresAt, token))
+    };
+}
+
+function verifyPresenceToken(identityPubKey, token, signature, expiresAt, now = Date.now()) {
+    const message = encodeTimestamped(PRESENCE_TOKEN_LABEL, expiresAt, token);
+    if (expiresAt <= now) {
+        return false;
+    }
+    return curve.verifySignature(identityPubKey, message, signature);
+}
+
+
+/*
+ * Prekey batch Merkle tree:
+ *
+ *   - the prekeys are sorted bytewise, so the root doesn't depend on upload order
+ *   - leaf = SHA-256(0x00 || prekey), node = SHA-256(0x01 || left || right)
+ *   - a level with an odd count pairs its last node with itself
+ *
+ * Because of that last rule [a, b, c] and [a, b, c, c] would share a root, so
+ * batches with repeated prekeys are rejected.  A membership proof is
+ * { index, leafCount, siblings } with index the leaf's position in sorted
+ * order, leafCount the batch size and siblings the hashes from the leaf level
+ * up.  Verification walks the tree shape leafCount implies: index must be
+ * below it, there must be exactly one sibling per level, and the last node of
+ * an odd level must be paired with itself.
+ */
+function merkleHash(prefix, ...parts) {
+    const hash = nodeCrypto.createHash('sha256').update(Buffer.from([prefix]));
+    for (const part of parts) {
+        hash.update(part);
+    }
+    return hash.digest();
+}
+
+function merkleLevels(preKeys) {
+    assertBufferArray(preKeys, 'preKeys');
+    if (!preKeys.length) {
+        throw new Error('Empty prekey batch');
+    }
+    const sorted = preKeys.slice().sort(Buffer.compare);
+    for (let i = 1; i < sorted.length; i++) {
+        if (sorted[i].equals(sorted[i - 1])) {
+            throw new Error('Duplicate prekey in batch');
+        }
+    }
+    const levels = [sorted.map(x => merkleHash(0, x))];
+    while (levels[levels.length - 1].length > 1) {
+        const level = levels[levels.length - 1];
+        const next = [];
+        for (let i = 0; i < level.length; i += 2) {
+            next.push(merkleHash(1, level[i], level[i + 1] || level[i]));
+        }
+        levels.push(next);
+    }
+    return {sorted, levels};
+}
+
+
+function prekeyBatchMerkleRoot(preKeys) {
+    const {levels} = merkleLevels(preKeys);
+    return levels[levels.length - 1][0];
+}
+
+
+function prekeyMembershipProof(preKeys, preKey) {
+    const {sorted, levels} = merkleLevels(preKeys);
+    const index = sorted.findIndex(x => x.equals(preKey));
+    if (index === -1) {
+        throw new Error('Prekey not in batch');
+    }
+    const siblings = [];
+    let position = index;
+    for (const level of levels.slice(0, -1)) {
+        const sibling = position ^ 1;
+        siblings.push(level[sibling] || level[position]);
+        position >>= 1;
+    }
+    return {index, leafCount: sorted.length, siblings};
+}
+
+
+function verifyPrekeyMembership(root, preKey, proof) {
+    if (!(root instanceof Buffer) || !(preKey instanceof Buffer) || !proof ||
+        !Number.isInteger(proof.index) || !Number.isInteger(proof.leafCount) ||
+        proof.index < 0 || proof.index >= proof.leafCount) {
+        return false;
+    }
+    assertBufferArray(proof.siblings, 'proof.siblings');
+    let node = merkleHash(0, preKey);
+    let position = proof.index;
+    let width = proof.leafCount;
+    for (const sibling of proof.siblings) {
+        if (width === 1) {
+            return false;
+        }
+        if ((position ^ 1) >= width && !sibling.equals(node)) {
+            return false;
+        }
+        node = position & 1 ? merkleHash(1, sibling, node) : merkleHash(1, node, sibling);
+        position >>= 1;
+        width = Math.ceil(width / 2);
+    }
+    return width === 1 && root.byteLength === node.byteLength &&
+        nodeCrypto.timingSafeEqual(root, node);
+}
+
+module.exports = {
+    commitPrekeyUpload,
+    prekeyBatchMerkleRoot,
+    prekeyMembershipProof,
+    signAggregatePreKeys,
+    signAuthChallenge,
+    signCapabilities,
+    signPresenceToken,
+    signSyncToken,
+    validateMessageTimestamp,
+    verifyAggregatePreKeySignature,
+    verifyAuthChallenge,
+    verifyCapabilities,
+    verifyPrekeyMembership,
+    verifyPrekeyUploadCommitment,
+    verifyPresenceToken,
+    verifySyncToken
+};
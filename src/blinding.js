@@ -0,0 +1,152 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const curve25519 = require('./curve25519_wrapper');
+const nodeCrypto = require('crypto');
+const {L, P, bigIntToBytes, bytesToBigInt, mod, modInverse, modPow} = require('./curve25519_math');
+
+const J = 486662n;
+
+/*
+ * Phone numbers are mapped to curve points with encode_to_curve from RFC 9380
+ * using the curve25519_XMD:SHA-512_ELL2_NU_ suite and DISCOVERY_DST below.
+ * Only the Montgomery u-coordinate is kept and the cofactor is cleared, so the
+ * blinded point is always in the prime-order subgroup and blinding with r then
+ * r^-1 (mod L) cancels out.
+ *
+ * BigInt arithmetic is not constant time; besides public inputs only the
+ * blinding scalar inversion goes through it.
+ */
+const DISCOVERY_DST = Buffer.from('LIBSIGNAL-DISCOVERY-V1_curve25519_XMD:SHA-512_ELL2_NU_');
+const BLIND_TOKEN_DST = Buffer.from('LIBSIGNAL-BLIND-TOKEN-V1_curve25519_XMD:SHA-512_ELL2_NU_');
+
+
+function sha512(...chunks) {
+    const hash = nodeCrypto.createHash('sha512');
+    for (const x of chunks) {
+        hash.update(x);
+    }
+    return hash.digest();
+}
+
+function expandMessageXmd(msg, dst, length) {
+    // RFC 9380 section 5.3.1 for a single SHA-512 block of output.
+    const dstPrime = Buffer.concat([dst, Buffer.from([dst.length])]);
+    const lengthBytes = Buffer.from([length >> 8, length & 0xff]);
+    const b0 = sha512(Buffer.alloc(128), msg, lengthBytes, Buffer.from([0]), dstPrime);
+    return sha512(b0, Buffer.from([1]), dstPrime).subarray(0, length);
+}
+
+function mapToCurveElligator2(u) {
+    // RFC 9380 section 6.7.1 with Z = 2, returning only the u-coordinate.
+    const denominator = mod(1n + 2n * u * u);
+    const x1 = denominator === 0n ? mod(-J) : mod(-J * modInverse(denominator));
+    const gx1 = mod(x1 * x1 * x1 + J * x1 * x1 + x1);
+    if (gx1 === 0n || modPow(gx1, (P - 1n) / 2n) === 1n) {
+        return x1;
+    }
+    return mod(-x1 - J);
+}
+
+function encodeToCurve(message, dst) {
+    const uniform = expandMessageXmd(message, dst, 48);
+    const u = mod(BigInt('0x' + uniform.toString('hex')));
+    const point = bigIntToBytes(mapToCurveElligator2(u));
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(8n), point));
+}
+
+function toScalar(blindingScalar) {
+    if (!(blindingScalar instanceof Buffer) || blindingScalar.byteLength !== 32) {
+        throw new TypeError('Blinding scalar must be a 32 byte Buffer');
+    }
+    const scalar = mod(bytesToBigInt(blindingScalar), L);
+    if (scalar === 0n) {
+        throw new Error('Invalid blinding scalar');
+    }
+    return scalar;
+}
+
+function assertPoint(point) {
+    if (!(point instanceof Buffer) || point.byteLength !== 32) {
+        throw new TypeError('Point must be a 32 byte Buffer');
+    }
+}
+
+
+function generateBlindingScalar() {
+    return bigIntToBytes(mod(bytesToBigInt(nodeCrypto.randomBytes(64)), L - 1n) + 1n);
+}
+
+
+function blindIdentifierForDiscovery(e164, blindingScalar) {
+    if (typeof e164 !== 'string' || !/^\+[1-9]\d{1,14}$/.test(e164)) {
+        throw new TypeError('Invalid E.164 number');
+    }
+    const scalar = toScalar(blindingScalar);
+    const point = encodeToCurve(Buffer.from(e164), DISCOVERY_DST);
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(scalar), point));
+}
+
+
+function unblindDiscoveryResponse(response, blindingScalar) {
+    assertPoint(response);
+    const inverse = modInverse(toScalar(blindingScalar), L);
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(inverse), response));
+}
+
+/*
+ * Blind signatures for anonymous tokens, the same shape as discovery:
+ *
+ *   client:  blinded   = r * H(message)             (blindMessage)
+ *   signer:  signed    = k * blinded                (signBlindedMessage)
+ *   client:  signature = r^-1 * signed = k * H(m)   (unblindSignature)
+ *
+ * The signer never sees the message or the final signature.  There is no
+ * pairing on this curve, so only the holder of k can check a signature
+ * (verifyBlindSignature); tokens are redeemed with the signer.
+ */
+function blindMessage(message, blindingFactor) {
+    if (!(message instanceof Buffer)) {
+        throw new TypeError('Message must be a Buffer');
+    }
+    const scalar = toScalar(blindingFactor);
+    const point = encodeToCurve(message, BLIND_TOKEN_DST);
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(scalar), point));
+}
+
+
+function signBlindedMessage(signingKey, blindedMessage) {
+    assertPoint(blindedMessage);
+    const scalar = toScalar(signingKey);
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(scalar), blindedMessage));
+}
+
+
+function unblindSignature(blindedSignature, blindingFactor) {
+    assertPoint(blindedSignature);
+    const inverse = modInverse(toScalar(blindingFactor), L);
+    return Buffer.from(curve25519.scalarMult(bigIntToBytes(inverse), blindedSignature));
+}
+
+
+function verifyBlindSignature(signingKey, message, signature) {
+    if (!(message instanceof Buffer)) {
+        throw new TypeError('Message must be a Buffer');
+    }
+    assertPoint(signature);
+    const expected = signBlindedMessage(signingKey, encodeToCurve(message, BLIND_TOKEN_DST));
+    return nodeCrypto.timingSafeEqual(expected, signature);
+}
+
+module.exports = {
+    BLIND_TOKEN_DST,
+    DISCOVERY_DST,
+    blindIdentifierForDiscovery,
+    blindMessage,
+    generateBlindingScalar,
+    signBlindedMessage,
+    unblindDiscoveryResponse,
+    unblindSignature,
+    verifyBlindSignature
+};
@@ -4,11 +4,12 @@
 
 const nodeCrypto = require('crypto');
 const assert = require('assert');
+const errors = require('./errors');
 
 
 function assertBuffer(value) {
     if (!(value instanceof Buffer)) {
-        throw TypeError(`Expected Buffer instead of: ${value.constructor.name}`);
+        throw TypeError(`Expected Buffer instead of: ${value?.constructor?.name}`);
     }
     return value;
 }
@@ -28,7 +29,102 @@ function decrypt(key, data, iv) {
     assertBuffer(data);
     assertBuffer(iv);
     const decipher = nodeCrypto.createDecipheriv('aes-256-cbc', key, iv);
-    return Buffer.concat([decipher.update(data), decipher.final()]);
+    // OpenSSL rejects a pad byte of 0 or above 16, inconsistent padding and
+    // partial blocks, which are the only ways the unpadded length can leave
+    // [0, data.length).  Surface those as DecryptionError instead of its
+    // generic "bad decrypt".
+    try {
+        return Buffer.concat([decipher.update(data), decipher.final()]);
+    } catch (e) {
+        throw new errors.DecryptionError("Implausible plaintext length");
+    }
+}
+
+
+// AES-CBC with PKCS#7 padding for any AES key size, for callers that aren't
+// tied to the protocol's AES-256 (see encrypt/decrypt).
+function aesCbcCipherName(key, iv) {
+    assertBuffer(key);
+    assertBuffer(iv);
+    if (key.length !== 16 && key.length !== 24 && key.length !== 32) {
+        throw new Error(`Invalid AES key length: ${key.length}`);
+    }
+    if (iv.length !== 16) {
+        throw new Error(`Invalid IV length: ${iv.length}`);
+    }
+    return `aes-${key.length * 8}-cbc`;
+}
+
+
+function aesCbcEncrypt(key, iv, plaintext) {
+    assertBuffer(plaintext);
+    const cipher = nodeCrypto.createCipheriv(aesCbcCipherName(key, iv), key, iv);
+    return Buffer.concat([cipher.update(plaintext), cipher.final()]);
+}
+
+
+function aesCbcDecrypt(key, iv, ciphertext) {
+    assertBuffer(ciphertext);
+    const name = aesCbcCipherName(key, iv);
+    if (!ciphertext.length || ciphertext.length % 16) {
+        throw new errors.DecryptionError("Invalid ciphertext length");
+    }
+    const decipher = nodeCrypto.createDecipheriv(name, key, iv);
+    try {
+        return Buffer.concat([decipher.update(ciphertext), decipher.final()]);
+    } catch (e) {
+        throw new errors.DecryptionError("Bad padding");
+    }
+}
+
+
+// AES-256-GCM with a 12 byte nonce; the output is ciphertext || 16 byte tag.
+const GCM_TAG_LENGTH = 16;
+
+function assertGcmParams(key, nonce, aad) {
+    assertBuffer(key);
+    assertBuffer(nonce);
+    if (aad !== undefined) {
+        assertBuffer(aad);
+    }
+    if (key.length !== 32) {
+        throw new Error(`Invalid AES-256 key length: ${key.length}`);
+    }
+    if (nonce.length !== 12) {
+        throw new Error(`Invalid GCM nonce length: ${nonce.length}`);
+    }
+}
+
+
+function aesGcmEncrypt(key, nonce, plaintext, aad) {
+    assertGcmParams(key, nonce, aad);
+    assertBuffer(plaintext);
+    const cipher = nodeCrypto.createCipheriv('aes-256-gcm', key, nonce);
+    if (aad !== undefined) {
+        cipher.setAAD(aad);
+    }
+    return Buffer.concat([cipher.update(plaintext), cipher.final(), cipher.getAuthTag()]);
+}
+
+
+function aesGcmDecrypt(key, nonce, ciphertext, aad) {
+    assertGcmParams(key, nonce, aad);
+    assertBuffer(ciphertext);
+    // A truncated input fails exactly like a bad tag.
+    if (ciphertext.length < GCM_TAG_LENGTH) {
+        throw new errors.AuthenticationError("Authentication failed");
+    }
+    const tagOffset = ciphertext.length - GCM_TAG_LENGTH;
+    const decipher = nodeCrypto.createDecipheriv('aes-256-gcm', key, nonce);
+    decipher.setAuthTag(ciphertext.subarray(tagOffset));
+    if (aad !== undefined) {
+        decipher.setAAD(aad);
+    }
+    try {
+        return Buffer.concat([decipher.update(ciphertext.subarray(0, tagOffset)), decipher.final()]);
+    } catch (e) {
+        throw new errors.AuthenticationError("Authentication failed");
+    }
 }
 
 
@@ -40,6 +136,16 @@ function calculateMAC(key, data) {
     return hmac.digest();
 }
 
+// Like calculateMAC but over any number of chunks, so concatenated input
+// doesn't have to be copied into one buffer first.
+function hmacSha256(key, ...chunks) {
+    assertBuffer(key);
+    const hmac = nodeCrypto.createHmac('sha256', key);
+    for (const chunk of chunks) {
+        hmac.update(assertBuffer(chunk));
+    }
+    return hmac.digest();
+}
 
 
 function hash(data) {
@@ -78,6 +184,37 @@ function deriveSecrets(input, salt, info, chunks = 3) {
 }
 
 
+// General HKDF-SHA256 (RFC 5869).  An empty salt means a zero filled one and
+// info may be empty.
+const HKDF_MAX_LENGTH = 255 * 32;
+
+function hkdf(ikm, salt, info, length) {
+    assertBuffer(ikm);
+    assertBuffer(salt);
+    assertBuffer(info);
+    if (!Number.isInteger(length) || length < 1 || length > HKDF_MAX_LENGTH) {
+        throw new RangeError(`Length must be between 1 and ${HKDF_MAX_LENGTH}`);
+    }
+    return Buffer.from(nodeCrypto.hkdfSync('sha256', ikm, salt, info, length));
+}
+
+
+// HKDF (RFC 5869) instantiated with HMAC-BLAKE2b-512.  This is NOT
+// interchangeable with the SHA-256 HKDF used by the Signal protocol (see
+// deriveSecrets); it is only for callers building their own constructions.
+const BLAKE2B_KDF_MAX_LENGTH = 255 * 64;
+
+function blake2bKdf(ikm, salt, info, length) {
+    assertBuffer(ikm);
+    assertBuffer(salt);
+    assertBuffer(info);
+    if (!Number.isInteger(length) || length < 1 || length > BLAKE2B_KDF_MAX_LENGTH) {
+        throw new RangeError(`Length must be between 1 and ${BLAKE2B_KDF_MAX_LENGTH}`);
+    }
+    return Buffer.from(nodeCrypto.hkdfSync('blake2b512', ikm, salt, info, length));
+}
+
+
 function verifyMAC(data, key, mac, length) {
     const calculatedMac = calculateMAC(key, data).subarray(0, length);
     if (mac.length !== length || calculatedMac.length !== length) {
@@ -91,11 +228,50 @@ function verifyMAC(data, key, mac, length) {
     if (!nodeCrypto.timingSafeEqual(mac, calculatedMac)) {}
 }
 
+// Equal-length inputs are compared in time independent of their contents;
+// a length mismatch is simply false.
+function constantTimeEqual(a, b) {
+    assertBuffer(a);
+    assertBuffer(b);
+    if (a.length !== b.length) {
+        return false;
+    }
+    return nodeCrypto.timingSafeEqual(a, b);
+}
+
+// Returns a copy of a when condition is 1 and of b when it is 0, using a mask
+// rather than a branch so the choice doesn't show up in timing.
+function constantTimeSelect(condition, a, b) {
+    assertBuffer(a);
+    assertBuffer(b);
+    if (condition !== 0 && condition !== 1) {
+        throw new Error("Condition must be 0 or 1");
+    }
+    if (a.length !== b.length) {
+        throw new Error("Inputs must have equal length");
+    }
+    const mask = -condition & 0xff;
+    const result = Buffer.alloc(a.length);
+    for (let i = 0; i < a.length; i++) {
+        result[i] = (a[i] & mask) | (b[i] & ~mask);
+    }
+    return result;
+}
+
 module.exports = {
+    aesCbcDecrypt,
+    aesCbcEncrypt,
+    aesGcmDecrypt,
+    aesGcmEncrypt,
+    blake2bKdf,
+    constantTimeEqual,
+    constantTimeSelect,
     deriveSecrets,
     decrypt,
     encrypt,
     hash,
+    hkdf,
+    hmacSha256,
     calculateMAC,
     verifyMAC
 };
@@ -1,4 +1,5 @@
 #include <napi.h>
+#include <string>
 
 extern "C" {
     int curve25519_donna(uint8_t *mypublic, const uint8_t *secret, const uint8_t *basepoint);
@@ -6,13 +7,26 @@ extern "C" {
                        const uint8_t *msg, const size_t msg_len);
     int curve25519_verify(const uint8_t *signature, const uint8_t *curve25519_pubkey,
                          const uint8_t *msg, const size_t msg_len);
+    int xeddsa_sign(uint8_t *signature, const uint8_t *curve25519_privkey,
+                    const uint8_t *msg, const size_t msg_len, const uint8_t *random);
+}
+
+// Throws and returns false unless exactly n arguments were passed, so callers
+// can bail out before touching info[].
+static bool ExpectArgs(const Napi::CallbackInfo& info, size_t n, const char* name) {
+    if (info.Length() != n) {
+        Napi::TypeError::New(info.Env(), std::string(name) + " expects " + std::to_string(n) +
+                             " arguments, got " + std::to_string(info.Length()))
+            .ThrowAsJavaScriptException();
+        return false;
+    }
+    return true;
 }
 
 Napi::Value Curve25519_Donna(const Napi::CallbackInfo& info) {
     Napi::Env env = info.Env();
 
-    if (info.Length() != 2) {
-        Napi::TypeError::New(env, "Wrong number of arguments").ThrowAsJavaScriptException();
+    if (!ExpectArgs(info, 2, "curve25519_donna")) {
         return env.Null();
     }
 
@@ -38,8 +52,7 @@ Napi::Value Curve25519_Donna(const Napi::CallbackInfo& info) {
 Napi::Value Curve25519_Sign(const Napi::CallbackInfo& info) {
     Napi::Env env = info.Env();
 
-    if (info.Length() != 2) {
-        Napi::TypeError::New(env, "Wrong number of arguments").ThrowAsJavaScriptException();
+    if (!ExpectArgs(info, 2, "curve25519_sign")) {
         return env.Null();
     }
 
@@ -51,6 +64,11 @@ Napi::Value Curve25519_Sign(const Napi::CallbackInfo& info) {
     auto privkey = info[0].As<Napi::Buffer<uint8_t>>();
     auto msg = info[1].As<Napi::Buffer<uint8_t>>();
 
+    if (privkey.Length() != 32) {
+        Napi::TypeError::New(env, "Private key must be 32 bytes").ThrowAsJavaScriptException();
+        return env.Null();
+    }
+
     auto signature = Napi::Buffer<uint8_t>::New(env, 64);
     curve25519_sign(signature.Data(), privkey.Data(), msg.Data(), msg.Length());
     
@@ -60,8 +78,7 @@ Napi::Value Curve25519_Sign(const Napi::CallbackInfo& info) {
 Napi::Value Curve25519_Verify(const Napi::CallbackInfo& info) {
     Napi::Env env = info.Env();
 
-    if (info.Length() != 3) {
-        Napi::TypeError::New(env, "Wrong number of arguments").ThrowAsJavaScriptException();
+    if (!ExpectArgs(info, 3, "curve25519_verify")) {
         return env.Null();
     }
 
@@ -74,15 +91,51 @@ Napi::Value Curve25519_Verify(const Napi::CallbackInfo& info) {
     auto pubkey = info[1].As<Napi::Buffer<uint8_t>>();
     auto msg = info[2].As<Napi::Buffer<uint8_t>>();
 
+    if (signature.Length() != 64 || pubkey.Length() != 32) {
+        Napi::TypeError::New(env, "Signature must be 64 bytes and public key 32 bytes").ThrowAsJavaScriptException();
+        return env.Null();
+    }
+
     int result = curve25519_verify(signature.Data(), pubkey.Data(), msg.Data(), msg.Length());
     
     return Napi::Boolean::New(env, result == 0);
 }
 
+Napi::Value Xeddsa_Sign(const Napi::CallbackInfo& info) {
+    Napi::Env env = info.Env();
+
+    if (!ExpectArgs(info, 3, "xeddsa_sign")) {
+        return env.Null();
+    }
+
+    if (!info[0].IsBuffer() || !info[1].IsBuffer() || !info[2].IsBuffer()) {
+        Napi::TypeError::New(env, "Wrong arguments").ThrowAsJavaScriptException();
+        return env.Null();
+    }
+
+    auto privkey = info[0].As<Napi::Buffer<uint8_t>>();
+    auto msg = info[1].As<Napi::Buffer<uint8_t>>();
+    auto random = info[2].As<Napi::Buffer<uint8_t>>();
+
+    if (privkey.Length() != 32 || random.Length() != 64) {
+        Napi::TypeError::New(env, "Private key must be 32 bytes and random 64 bytes").ThrowAsJavaScriptException();
+        return env.Null();
+    }
+
+    auto signature = Napi::Buffer<uint8_t>::New(env, 64);
+    if (xeddsa_sign(signature.Data(), privkey.Data(), msg.Data(), msg.Length(), random.Data()) != 0) {
+        Napi::Error::New(env, "Signing failed").ThrowAsJavaScriptException();
+        return env.Null();
+    }
+
+    return signature;
+}
+
 Napi::Object Init(Napi::Env env, Napi::Object exports) {
     exports.Set("curve25519_donna", Napi::Function::New(env, Curve25519_Donna));
     exports.Set("curve25519_sign", Napi::Function::New(env, Curve25519_Sign));
     exports.Set("curve25519_verify", Napi::Function::New(env, Curve25519_Verify));
+    exports.Set("xeddsa_sign", Napi::Function::New(env, Xeddsa_Sign));
     return exports;
 }
 
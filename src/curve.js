@@ -1,29 +1,68 @@
 "use strict";
 
 const curve25519 = require("../src/curve25519_wrapper");
+const errors = require("./errors");
+const curveMath = require("./curve25519_math");
 const nodeCrypto = require("crypto");
 
+const {
+  EMPTY_MESSAGE,
+  INVALID_PRIVATE_KEY,
+  INVALID_PUBLIC_KEY,
+  INVALID_RANDOM,
+  INVALID_SHARED_SECRET,
+  INVALID_SIGNATURE,
+} = errors.ErrorCode;
+
+// Keys and messages may come from WebCrypto or other Uint8Array based code.
+// ArrayBuffers and typed array views become Buffers over the same memory,
+// respecting byteOffset and byteLength, so a subarray view is never read past
+// its bounds or mistaken for an empty buffer.  null and undefined pass through
+// to the callers' own checks.
+function toBuffer(value, what, code) {
+  if (value == null || value instanceof Buffer) {
+    return value;
+  }
+  if (value instanceof ArrayBuffer) {
+    return Buffer.from(value);
+  }
+  if (ArrayBuffer.isView(value)) {
+    return Buffer.from(value.buffer, value.byteOffset, value.byteLength);
+  }
+  const message = `Invalid ${what} type: ${value?.constructor?.name}`;
+  throw code ? new errors.CurveError(code, message) : new TypeError(message);
+}
+
 function validatePrivKey(privKey) {
   if (privKey === undefined) {
-    throw new Error("Undefined private key");
+    throw new errors.CurveError(INVALID_PRIVATE_KEY, "Undefined private key");
   }
   if (!(privKey instanceof Buffer)) {
-    throw new Error(`Invalid private key type: ${privKey?.constructor?.name}`);
+    throw new errors.CurveError(
+      INVALID_PRIVATE_KEY,
+      `Invalid private key type: ${privKey?.constructor?.name}`,
+    );
   }
   if (privKey.byteLength != 32) {
-    throw new Error(`Incorrect private key length: ${privKey?.byteLength}`);
+    throw new errors.CurveError(
+      INVALID_PRIVATE_KEY,
+      `Incorrect private key length: ${privKey?.byteLength}`,
+    );
   }
 }
 
 function scrubPubKeyFormat(pubKey) {
   if (!(pubKey instanceof Buffer)) {
-    throw new Error(`Invalid public key type: ${pubKey?.constructor?.name}`);
+    throw new errors.CurveError(
+      INVALID_PUBLIC_KEY,
+      `Invalid public key type: ${pubKey?.constructor?.name}`,
+    );
   }
   if (
     pubKey === undefined ||
     ((pubKey.byteLength != 33 || pubKey[0] != 5) && pubKey.byteLength != 32)
   ) {
-    throw new Error("Invalid public key");
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
   }
   if (pubKey.byteLength == 33) {
     return pubKey.subarray(1);
@@ -36,6 +75,7 @@ function scrubPubKeyFormat(pubKey) {
 }
 
 exports.createKeyPair = function (privKey) {
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
   validatePrivKey(privKey);
   const keys = curve25519.keyPair(privKey);
   var origPub = new Uint8Array(keys.pubKey);
@@ -48,38 +88,329 @@ exports.createKeyPair = function (privKey) {
   };
 };
 
+// With a clamped scalar every small-order peer key (u = 0, 1, p - 1, the two
+// order 8 points, and the non-canonical p and p + 1) yields the all-zero
+// secret, so checking the output catches all of them.
+// No early exit.
+function isAllZero(secret) {
+  let acc = 0;
+  for (let i = 0; i < secret.length; i++) {
+    acc |= secret[i];
+  }
+  return acc === 0;
+}
+
+function checkSharedSecret(secret) {
+  if (isAllZero(secret)) {
+    throw new errors.CurveError(INVALID_SHARED_SECRET, "Invalid shared secret");
+  }
+  return secret;
+}
+
 exports.calculateAgreement = function (pubKey, privKey) {
-  pubKey = scrubPubKeyFormat(pubKey);
+  pubKey = scrubPubKeyFormat(toBuffer(pubKey, "public key", INVALID_PUBLIC_KEY));
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
   validatePrivKey(privKey);
   if (!pubKey || pubKey.byteLength != 32) {
-    throw new Error("Invalid public key");
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
   }
-  return Buffer.from(curve25519.sharedSecret(pubKey, privKey));
+  return checkSharedSecret(Buffer.from(curve25519.sharedSecret(pubKey, privKey)));
+};
+
+// One agreement per peer key, in order.  All keys are validated before any
+// agreement runs, and a bad one is reported by index.
+exports.calculateAgreementBatch = function (pubKeys, privKey) {
+  if (!Array.isArray(pubKeys)) {
+    throw new TypeError("pubKeys must be an array");
+  }
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
+  validatePrivKey(privKey);
+  const scrubbed = pubKeys.map((pubKey, i) => {
+    try {
+      return scrubPubKeyFormat(toBuffer(pubKey, "public key", INVALID_PUBLIC_KEY));
+    } catch (e) {
+      throw new errors.CurveError(
+        e.code || INVALID_PUBLIC_KEY,
+        `Invalid public key at index ${i}: ${e.message}`,
+      );
+    }
+  });
+  return scrubbed.map((pubKey, i) => {
+    try {
+      return checkSharedSecret(Buffer.from(curve25519.sharedSecret(pubKey, privKey)));
+    } catch (e) {
+      throw new errors.CurveError(e.code, `Invalid shared secret at index ${i}`);
+    }
+  });
+};
+
+// Whether the agreement with this peer key depends on our private key at all.
+// Clamping clears the cofactor, so a small-order peer key is the only way to
+// get a fixed output, and that output is all zeroes.  calculateAgreement throws
+// on it; this reports false instead for protocols that branch on it.  Badly
+// formatted keys still throw.
+exports.isContributoryAgreement = function (pubKey, privKey) {
+  pubKey = scrubPubKeyFormat(toBuffer(pubKey, "public key", INVALID_PUBLIC_KEY));
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
+  validatePrivKey(privKey);
+  const secret = Buffer.from(curve25519.sharedSecret(pubKey, privKey));
+  try {
+    return !isAllZero(secret);
+  } finally {
+    secret.fill(0);
+  }
+};
+
+exports.verifyStoredAgreement = function (peerPubKey, privKey, expectedSecret) {
+  const secret = exports.calculateAgreement(peerPubKey, privKey);
+  if (!(expectedSecret instanceof Buffer) || expectedSecret.byteLength != secret.byteLength) {
+    return false;
+  }
+  return nodeCrypto.timingSafeEqual(secret, expectedSecret);
 };
 
 exports.calculateSignature = function (privKey, message) {
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
+  message = toBuffer(message, "message");
   validatePrivKey(privKey);
   if (!message) {
-    throw new Error("Invalid message");
+    throw new errors.CurveError(EMPTY_MESSAGE, "Invalid message");
   }
   return Buffer.from(curve25519.sign(privKey, message));
 };
 
+// XEdDSA as specified by Signal: a randomized signature made with the Montgomery
+// private key, which verifies with verifySignature.  random is 64 bytes and
+// only needs to be passed in for reproducible output.
+exports.xeddsaSign = function (privKey, message, random) {
+  privKey = toBuffer(privKey, "private key", INVALID_PRIVATE_KEY);
+  message = toBuffer(message, "message");
+  random = toBuffer(random, "random", INVALID_RANDOM);
+  validatePrivKey(privKey);
+  if (!message) {
+    throw new errors.CurveError(EMPTY_MESSAGE, "Invalid message");
+  }
+  if (random === undefined) {
+    random = nodeCrypto.randomBytes(64);
+  } else if (!(random instanceof Buffer) || random.byteLength != 64) {
+    throw new errors.CurveError(INVALID_RANDOM, "Random must be 64 bytes");
+  }
+  return Buffer.from(curve25519.xeddsaSign(privKey, message, random));
+};
+
+// Verifies a signature from xeddsaSign or calculateSignature against a
+// Montgomery public key, the way libsignal does.  The key is mapped to its
+// Edwards form with the sign bit taken from sig[63] & 0x80.  That bit is then
+// cleared from s.  Unlike verifySignature, this also rejects non-canonical u
+// coordinates and an s of 2^253 or more.
+exports.xeddsaVerify = function (pubKey, message, sig) {
+  pubKey = scrubPubKeyFormat(toBuffer(pubKey, "public key", INVALID_PUBLIC_KEY));
+  message = toBuffer(message, "message");
+  sig = toBuffer(sig, "signature", INVALID_SIGNATURE);
+  if (!message) {
+    throw new errors.CurveError(EMPTY_MESSAGE, "Invalid message");
+  }
+  if (!sig || sig.byteLength != 64) {
+    throw new errors.CurveError(INVALID_SIGNATURE, "Invalid signature");
+  }
+  // With the sign bit masked off, bits 253 and 254 must be clear.
+  if (curveMath.bytesToBigInt(pubKey) >= curveMath.P || sig[63] & 0x60) {
+    return false;
+  }
+  return curve25519.verify(pubKey, message, sig);
+};
+
+// isInit only relaxes the key format: identity keys received during session
+// setup may arrive without the 0x05 prefix, so a bare 32 byte key is accepted
+// without the warning.  The signature itself is always checked.
 exports.verifySignature = function (pubKey, msg, sig, isInit) {
-  pubKey = scrubPubKeyFormat(pubKey);
+  pubKey = toBuffer(pubKey, "public key", INVALID_PUBLIC_KEY);
+  msg = toBuffer(msg, "message");
+  sig = toBuffer(sig, "signature", INVALID_SIGNATURE);
+  if (!(isInit && pubKey instanceof Buffer && pubKey.byteLength == 32)) {
+    pubKey = scrubPubKeyFormat(pubKey);
+  }
   if (!pubKey || pubKey.byteLength != 32) {
-    throw new Error("Invalid public key");
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
   }
   if (!msg) {
-    throw new Error("Invalid message");
+    throw new errors.CurveError(EMPTY_MESSAGE, "Invalid message");
   }
   if (!sig || sig.byteLength != 64) {
-    throw new Error("Invalid signature");
+    throw new errors.CurveError(INVALID_SIGNATURE, "Invalid signature");
   }
-  return isInit ? true : curve25519.verify(pubKey, msg, sig);
+  return curve25519.verify(pubKey, msg, sig);
+};
+
+// Verifies and returns the SHA-256 of the message for indexing.  On failure
+// the hash is all zeroes so an unverified message can't be indexed by mistake.
+exports.verifyAndHash = function (pubKey, message, sig) {
+  if (!exports.verifySignature(pubKey, message, sig)) {
+    return { valid: false, hash: Buffer.alloc(32) };
+  }
+  return {
+    valid: true,
+    hash: nodeCrypto.createHash("sha256").update(message).digest(),
+  };
+};
+
+// DER SubjectPublicKeyInfo header for a raw 32 byte Ed25519 public key.
+const ED25519_SPKI_PREFIX = Buffer.from("302a300506032b6570032100", "hex");
+
+exports.verifyLibsodiumSignature = function (publicKey, msg, sig) {
+  // libsodium keys are Edwards points, not the Montgomery keys used elsewhere here,
+  // so this is a plain Ed25519 verification.
+  if (!(publicKey instanceof Buffer) || publicKey.byteLength != 32) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
+  }
+  if (!msg) {
+    throw new errors.CurveError(EMPTY_MESSAGE, "Invalid message");
+  }
+  if (!sig || sig.byteLength != 64) {
+    throw new errors.CurveError(INVALID_SIGNATURE, "Invalid signature");
+  }
+  let key;
+  try {
+    key = nodeCrypto.createPublicKey({
+      key: Buffer.concat([ED25519_SPKI_PREFIX, publicKey]),
+      format: "der",
+      type: "spki",
+    });
+  } catch (e) {
+    return false;
+  }
+  return nodeCrypto.verify(null, msg, key, sig);
 };
 
 exports.generateKeyPair = function () {
   const privKey = nodeCrypto.randomBytes(32);
   return exports.createKeyPair(privKey);
 };
+
+const MAX_DISTINCT_KEY_ATTEMPTS = 16;
+
+// A fresh key pair whose public key is none of the keys in avoid (32 or 33
+// byte forms).  A collision is not realistically possible; this just makes
+// the guarantee explicit.
+exports.generateDistinctKeyPair = function (avoid) {
+  if (!Array.isArray(avoid)) {
+    throw new TypeError("avoid must be an array");
+  }
+  const seen = new Set(
+    avoid.map((key) => {
+      if (!(key instanceof Buffer) || (key.byteLength != 32 && key.byteLength != 33)) {
+        throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
+      }
+      return key.subarray(key.byteLength - 32).toString("hex");
+    }),
+  );
+  for (let i = 0; i < MAX_DISTINCT_KEY_ATTEMPTS; i++) {
+    const keyPair = exports.generateKeyPair();
+    if (!seen.has(keyPair.pubKey.subarray(1).toString("hex"))) {
+      return keyPair;
+    }
+  }
+  throw new Error("Could not generate a distinct key pair");
+};
+
+const SUPPORTED_CURVES = ["curve25519"];
+
+exports.generateKeyPairForCurve = function (curve) {
+  if (!SUPPORTED_CURVES.includes(curve)) {
+    throw new Error(`Unsupported curve: ${curve}`);
+  }
+  return { curve, ...exports.generateKeyPair() };
+};
+
+exports.verifyContactPreKeys = function (identityPubKey, signedPreKeys) {
+  scrubPubKeyFormat(identityPubKey);
+  if (!Array.isArray(signedPreKeys)) {
+    throw new TypeError("signedPreKeys must be an array");
+  }
+  // A malformed entry only fails itself; the rest of the batch still gets checked.
+  return signedPreKeys.map((preKey) => {
+    try {
+      return exports.verifySignature(identityPubKey, preKey.publicKey, preKey.signature);
+    } catch (e) {
+      return false;
+    }
+  });
+};
+
+// All-or-nothing: true only when every { pubKey, message, signature } entry
+// verifies.  Every entry is checked even after a failure so the timing doesn't
+// reveal which one failed.
+exports.verifyAll = function (entries) {
+  if (!Array.isArray(entries) || !entries.length) {
+    throw new TypeError("entries must be a non-empty array");
+  }
+  let ok = 1;
+  for (const entry of entries) {
+    let valid = false;
+    try {
+      valid = exports.verifySignature(entry.pubKey, entry.message, entry.signature);
+    } catch (e) {
+      valid = false;
+    }
+    ok &= valid ? 1 : 0;
+  }
+  return ok === 1;
+};
+
+exports.isPrimeOrderPoint = function (pubKey) {
+  pubKey = scrubPubKeyFormat(pubKey);
+  if (!pubKey || pubKey.byteLength != 32) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid public key");
+  }
+  // Points on the twist, small-order points and points with a small-order
+  // component all fail; only L * P == identity (with P != identity) passes.
+  const point = curveMath.edwardsFromMontgomery(curveMath.mod(curveMath.bytesToBigInt(pubKey)));
+  if (!point || curveMath.isIdentity(point)) {
+    return false;
+  }
+  return curveMath.isIdentity(curveMath.edwardsMultiply(point, curveMath.L));
+};
+
+// WebCrypto exports X25519 public keys as the bare 32 byte u coordinate (an
+// ArrayBuffer from crypto.subtle.exportKey("raw", ...)); this adds the 0x05
+// type byte used everywhere else here.
+exports.importWebCryptoX25519 = function (rawPublic) {
+  rawPublic = toBuffer(rawPublic, "WebCrypto X25519 public key", INVALID_PUBLIC_KEY);
+  if (!(rawPublic instanceof Buffer) || rawPublic.byteLength != 32) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Invalid WebCrypto X25519 public key");
+  }
+  return Buffer.concat([Buffer.from([5]), rawPublic]);
+};
+
+// An Ed25519 public key from elsewhere (32 bytes) to the 32 byte X25519 u
+// coordinate, u = (1 + y) / (1 - y), for use in agreement.
+exports.convertEd25519PublicKey = function (edPubKey) {
+  edPubKey = toBuffer(edPubKey, "Ed25519 public key", INVALID_PUBLIC_KEY);
+  if (!(edPubKey instanceof Buffer) || edPubKey.byteLength != 32) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Ed25519 public key must be 32 bytes");
+  }
+  if (!curveMath.isEdwardsPoint(edPubKey)) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, "Ed25519 public key is not on the curve");
+  }
+  try {
+    return curveMath.montgomeryFromEdwards(edPubKey);
+  } catch (e) {
+    throw new errors.CurveError(INVALID_PUBLIC_KEY, e.message);
+  }
+};
+
+// The X25519 private key matching an Ed25519 seed: SHA-512(seed)[0:32],
+// clamped.  Its public key is convertEd25519PublicKey of the seed's Ed25519
+// public key.
+exports.convertEd25519PrivateKey = function (seed) {
+  if (!(seed instanceof Buffer) || seed.byteLength != 32) {
+    throw new errors.CurveError(INVALID_PRIVATE_KEY, "Ed25519 seed must be 32 bytes");
+  }
+  const digest = nodeCrypto.createHash("sha512").update(seed).digest();
+  const scalar = Buffer.from(digest.subarray(0, 32));
+  digest.fill(0);
+  scalar[0] &= 248;
+  scalar[31] &= 127;
+  scalar[31] |= 64;
+  return scalar;
+};
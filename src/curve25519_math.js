@@ -0,0 +1,148 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+/*
+ * Field and group arithmetic over curve25519 / edwards25519 with BigInt.  None of
+ * this is constant time, so keep secrets out of it; scalar multiplication with
+ * secret scalars goes through the native ladder instead.
+ */
+
+const P = (1n << 255n) - 19n;
+const L = (1n << 252n) + 27742317777372353535851937790883648493n;
+const D = 37095705934669439343138083508754565189542113879843219016388785533085940283555n;
+const SQRT_M1 = 19681161376707505956807079304988542015446066515923890162744021073123829784752n;
+
+
+function mod(a, m = P) {
+    const r = a % m;
+    return r < 0n ? r + m : r;
+}
+
+function modPow(base, exponent, m = P) {
+    let result = 1n;
+    base = mod(base, m);
+    for (; exponent > 0n; exponent >>= 1n) {
+        if (exponent & 1n) {
+            result = result * base % m;
+        }
+        base = base * base % m;
+    }
+    return result;
+}
+
+function modInverse(a, m = P) {
+    return modPow(a, m - 2n, m);
+}
+
+function bytesToBigInt(bytes) {
+    // Little endian, the curve25519 convention.
+    return BigInt('0x' + (Buffer.from(bytes).reverse().toString('hex') || '0'));
+}
+
+function bigIntToBytes(n) {
+    return Buffer.from(n.toString(16).padStart(64, '0'), 'hex').reverse();
+}
+
+function sqrt(a) {
+    // p = 5 (mod 8): candidate a^((p+3)/8), fixed up by sqrt(-1) if needed.
+    let x = modPow(a, (P + 3n) / 8n);
+    if (mod(x * x) !== mod(a)) {
+        x = mod(x * SQRT_M1);
+    }
+    return mod(x * x) === mod(a) ? x : null;
+}
+
+// Extended coordinates (X, Y, Z, T) with x = X/Z, y = Y/Z, xy = T/Z.
+const IDENTITY = [0n, 1n, 1n, 0n];
+
+function edwardsAdd([X1, Y1, Z1, T1], [X2, Y2, Z2, T2]) {
+    const A = mod((Y1 - X1) * (Y2 - X2));
+    const B = mod((Y1 + X1) * (Y2 + X2));
+    const C = mod(2n * D * T1 * T2);
+    const E = mod(2n * Z1 * Z2);
+    const F = B - A;
+    const G = E - C;
+    const H = E + C;
+    const I = B + A;
+    return [mod(F * G), mod(I * H), mod(G * H), mod(F * I)];
+}
+
+function edwardsMultiply(point, scalar) {
+    let result = IDENTITY;
+    for (let addend = point; scalar > 0n; scalar >>= 1n) {
+        if (scalar & 1n) {
+            result = edwardsAdd(result, addend);
+        }
+        addend = edwardsAdd(addend, addend);
+    }
+    return result;
+}
+
+function isIdentity([X, Y, Z]) {
+    return X === 0n && mod(Y - Z) === 0n;
+}
+
+function edwardsFromMontgomery(u) {
+    // Either sign of x gives the same subgroup answers, so the even root is used.
+    if (mod(u + 1n) === 0n) {
+        return null;
+    }
+    const y = mod((u - 1n) * modInverse(u + 1n));
+    const x = sqrt(mod((y * y - 1n) * modInverse(D * y * y + 1n)));
+    if (x === null) {
+        return null;
+    }
+    return [x, y, 1n, mod(x * y)];
+}
+
+// Whether 32 bytes are a valid Ed25519 point encoding (RFC 8032 5.1.3).
+function isEdwardsPoint(encoded) {
+    if (!(encoded instanceof Buffer) || encoded.byteLength !== 32) {
+        return false;
+    }
+    const sign = encoded[31] >> 7;
+    const y = bytesToBigInt(Buffer.from(encoded).fill(encoded[31] & 0x7f, 31));
+    if (y >= P) {
+        return false;
+    }
+    const x = sqrt(mod((y * y - 1n) * modInverse(D * y * y + 1n)));
+    return x !== null && !(x === 0n && sign === 1);
+}
+
+/*
+ * Birational map from an encoded Edwards y-coordinate (32 bytes little endian,
+ * sign bit of x ignored) to the Montgomery u-coordinate u = (1 + y) / (1 - y).
+ */
+function montgomeryFromEdwards(y) {
+    if (!(y instanceof Buffer) || y.byteLength !== 32) {
+        throw new TypeError('Edwards y-coordinate must be a 32 byte Buffer');
+    }
+    const encoded = Buffer.from(y);
+    encoded[31] &= 0x7f;
+    const value = bytesToBigInt(encoded);
+    if (value >= P) {
+        throw new Error('Non-canonical Edwards y-coordinate');
+    }
+    if (value === 1n) {
+        throw new Error('Edwards y-coordinate has no Montgomery image');
+    }
+    return bigIntToBytes(mod((1n + value) * modInverse(1n - value)));
+}
+
+
+module.exports = {
+    D,
+    L,
+    P,
+    bigIntToBytes,
+    bytesToBigInt,
+    edwardsFromMontgomery,
+    edwardsMultiply,
+    isEdwardsPoint,
+    isIdentity,
+    mod,
+    modInverse,
+    modPow,
+    montgomeryFromEdwards
+};
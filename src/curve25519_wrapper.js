@@ -16,16 +16,45 @@ exports.keyPair = function (privKey) {
   };
 };
 
+// Private key copies made for a single call are wiped once it returns, so the
+// key doesn't linger in memory beyond the caller's own buffer.
+function zero(buffer) {
+  buffer.fill(0);
+}
+
 exports.sharedSecret = function (pubKey, privKey) {
-  privKey[0] &= 248;
-  privKey[31] &= 127;
-  privKey[31] |= 64;
+  const priv = new Uint8Array(privKey);
+  priv[0] &= 248;
+  priv[31] &= 127;
+  priv[31] |= 64;
 
-  return crypto.curve25519_donna(new Uint8Array(privKey), new Uint8Array(pubKey)).buffer;
+  try {
+    return crypto.curve25519_donna(priv, new Uint8Array(pubKey)).buffer;
+  } finally {
+    zero(priv);
+  }
 };
 
 exports.sign = function (privKey, message) {
-  return crypto.curve25519_sign(new Uint8Array(privKey), new Uint8Array(message)).buffer;
+  const priv = new Uint8Array(privKey);
+  try {
+    return crypto.curve25519_sign(priv, new Uint8Array(message)).buffer;
+  } finally {
+    zero(priv);
+  }
+};
+
+exports.xeddsaSign = function (privKey, message, random) {
+  const priv = new Uint8Array(privKey);
+  priv[0] &= 248;
+  priv[31] &= 127;
+  priv[31] |= 64;
+
+  try {
+    return crypto.xeddsa_sign(priv, new Uint8Array(message), new Uint8Array(random)).buffer;
+  } finally {
+    zero(priv);
+  }
 };
 
 exports.verify = function (pubKey, message, sig) {
@@ -35,3 +64,13 @@ exports.verify = function (pubKey, message, sig) {
     new Uint8Array(message),
   );
 };
+
+exports.scalarMult = function (scalar, pubKey) {
+  // Unlike sharedSecret the scalar is used as is, without clamping.
+  const copy = new Uint8Array(scalar);
+  try {
+    return crypto.curve25519_donna(copy, new Uint8Array(pubKey)).buffer;
+  } finally {
+    zero(copy);
+  }
+};
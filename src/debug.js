@@ -0,0 +1,133 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+/*
+ * Integration diagnostics.  These deliberately leak which variant of an input
+ * matched, so index.js only exposes them when LIBSIGNAL_DEBUG is set.
+ */
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const nodeCrypto = require('crypto');
+
+// Welch t statistic above which timings are treated as distinguishable, as in dudect.
+const TIMING_T_THRESHOLD = 4.5;
+
+
+function macMatches(macKey, data, mac) {
+    return crypto.calculateMAC(macKey, data).subarray(0, mac.byteLength).equals(mac);
+}
+
+/*
+ * Works out why a MAC over versionByte || message didn't verify.  The common
+ * culprits are the sender leaving the version byte out or using another
+ * version, so each of those is tried in turn.
+ */
+function diagnoseMacFailure(macKey, versionByte, message, mac) {
+    if (!(macKey instanceof Buffer) || !(message instanceof Buffer) || !(mac instanceof Buffer)) {
+        throw new TypeError('macKey, message and mac must be Buffers');
+    }
+    if (!Number.isInteger(versionByte) || versionByte < 0 || versionByte > 0xff) {
+        throw new RangeError('Invalid version byte: ' + versionByte);
+    }
+    if (!mac.byteLength || mac.byteLength > 32) {
+        throw new RangeError('Invalid MAC length: ' + mac.byteLength);
+    }
+    const withVersion = version => Buffer.concat([Buffer.from([version]), message]);
+    if (macMatches(macKey, withVersion(versionByte), mac)) {
+        return {matched: true, includesVersion: true, versionByte};
+    }
+    if (macMatches(macKey, message, mac)) {
+        return {matched: true, includesVersion: false, versionByte: null};
+    }
+    for (let version = 0; version <= 0xff; version++) {
+        if (version !== versionByte && macMatches(macKey, withVersion(version), mac)) {
+            return {matched: true, includesVersion: true, versionByte: version};
+        }
+    }
+    return {matched: false, includesVersion: null, versionByte: null};
+}
+
+function summarize(timings) {
+    const mean = timings.reduce((a, b) => a + b, 0) / timings.length;
+    const variance = timings.reduce((a, b) => a + (b - mean) ** 2, 0) / (timings.length - 1);
+    return {mean, variance};
+}
+
+/*
+ * Times verifySignature on valid and on invalid signatures, interleaved so that
+ * drift in the runtime hits both sets equally, and reports whether the two
+ * distributions differ significantly (nanoseconds).
+ */
+function measureVerifyTiming(samples) {
+    if (!Number.isInteger(samples) || samples < 2) {
+        throw new RangeError('Invalid sample count: ' + samples);
+    }
+    const keyPair = curve.generateKeyPair();
+    const message = nodeCrypto.randomBytes(32);
+    const validSig = curve.calculateSignature(keyPair.privKey, message);
+    const invalidSig = Buffer.from(validSig);
+    invalidSig[0] ^= 1;
+    const timings = {valid: [], invalid: []};
+    for (let i = 0; i < samples; i++) {
+        for (const [kind, sig] of [['valid', validSig], ['invalid', invalidSig]]) {
+            const start = process.hrtime.bigint();
+            curve.verifySignature(keyPair.pubKey, message, sig);
+            timings[kind].push(Number(process.hrtime.bigint() - start));
+        }
+    }
+    const valid = summarize(timings.valid);
+    const invalid = summarize(timings.invalid);
+    const t = (valid.mean - invalid.mean) /
+        Math.sqrt(valid.variance / samples + invalid.variance / samples || 1);
+    return {
+        valid,
+        invalid,
+        t,
+        significant: Math.abs(t) > TIMING_T_THRESHOLD
+    };
+}
+
+function isPubKey(key) {
+    return key instanceof Buffer && key.byteLength === 33 && key[0] === 5;
+}
+
+function checkPoint(key) {
+    try {
+        return isPubKey(key) && curve.isPrimeOrderPoint(key);
+    } catch (e) {
+        return false;
+    }
+}
+
+/*
+ * Walks the X3DH trust chain and reports each link separately instead of
+ * stopping at the first failure, so integrators can see exactly where it broke.
+ */
+function traceMessageProvenance(identityPubKey, signedPreKeyPubKey, signedPreKeySignature,
+                                ephemeralPubKey) {
+    const report = {
+        identityKey: checkPoint(identityPubKey),
+        signedPreKey: checkPoint(signedPreKeyPubKey),
+        signedPreKeySignature: false,
+        ephemeralKey: checkPoint(ephemeralPubKey)
+    };
+    if (report.identityKey && report.signedPreKey) {
+        try {
+            report.signedPreKeySignature = curve.verifySignature(identityPubKey, signedPreKeyPubKey,
+                                                                 signedPreKeySignature);
+        } catch (e) {
+            report.signedPreKeySignature = false;
+        }
+    }
+    report.valid = report.identityKey && report.signedPreKey && report.signedPreKeySignature &&
+        report.ephemeralKey;
+    return report;
+}
+
+module.exports = {
+    diagnoseMacFailure,
+    measureVerifyTiming,
+    traceMessageProvenance
+};
@@ -0,0 +1,237 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const nodeCrypto = require('crypto');
+
+const TYPING_KEY_INFO = 'WhisperTypingIndicator';
+// Link previews ride in the message but are encrypted under their own key.
+const LINK_PREVIEW_KEY_INFO = 'WhisperLinkPreview';
+const NONCE_PREFIX_INFO = 'WhisperNoncePrefix';
+const CONVERSATION_META_KEY_INFO = 'WhisperConversationMeta';
+const DRAFT_KEY_INFO = 'WhisperDraft';
+const DEVICE_MESSAGE_KEY_INFO = 'WhisperDeviceMessageKey';
+const MAX_DEVICE_ID = 127;
+const ROOT_KEY_COMMITMENT_LABEL = 'WhisperRootKeyCommitment';
+const RATCHET_INFO = 'WhisperRatchet';
+const SYNC_MESSAGE_KEY_INFO = 'WhisperSyncMessageKey';
+
+// Labels used by the storage service; they must match the server's clients exactly.
+const STORAGE_SERVICE_LABEL = 'Storage Service Encryption';
+const REGISTRATION_LOCK_LABEL = 'Registration Lock';
+const MANIFEST_LABEL_PREFIX = 'Manifest_';
+const ITEM_LABEL_PREFIX = 'Item_';
+
+
+function assertKey(value, name, length = 32) {
+    if (!(value instanceof Buffer)) {
+        throw new TypeError(`Invalid ${name} type: ${value?.constructor?.name}`);
+    }
+    if (value.byteLength !== length) {
+        throw new Error(`Incorrect ${name} length: ${value.byteLength}`);
+    }
+}
+
+
+/*
+ * Typing indicators reuse one key per session instead of stepping the
+ * ratchet.  The info label keeps it separate from WhisperMessageKeys.
+ */
+function deriveTypingKey(sessionKey) {
+    assertKey(sessionKey, 'session key');
+    return crypto.deriveSecrets(sessionKey, Buffer.alloc(32), Buffer.from(TYPING_KEY_INFO), 1)[0];
+}
+
+/*
+ * Storage service keys are single HMAC-SHA256 steps keyed by the master key (or
+ * the storage key), not HKDF, to stay byte compatible with records written by
+ * the official clients.
+ */
+function deriveStorageKeys(masterKey) {
+    assertKey(masterKey, 'master key');
+    return {
+        storageKey: crypto.calculateMAC(masterKey, Buffer.from(STORAGE_SERVICE_LABEL)),
+        registrationLockKey: crypto.calculateMAC(masterKey, Buffer.from(REGISTRATION_LOCK_LABEL))
+    };
+}
+
+
+function deriveStorageManifestKey(storageKey, version) {
+    assertKey(storageKey, 'storage key');
+    if (!Number.isSafeInteger(version) || version < 0) {
+        throw new RangeError('Invalid manifest version: ' + version);
+    }
+    return crypto.calculateMAC(storageKey, Buffer.from(MANIFEST_LABEL_PREFIX + version));
+}
+
+
+function deriveStorageItemKey(storageKey, itemId) {
+    assertKey(storageKey, 'storage key');
+    if (!(itemId instanceof Buffer) || !itemId.byteLength) {
+        throw new TypeError('Invalid storage item id');
+    }
+    return crypto.calculateMAC(storageKey,
+                               Buffer.from(ITEM_LABEL_PREFIX + itemId.toString('base64')));
+}
+
+function assertConversationId(conversationId) {
+    // Direct conversations are keyed by a 16 byte UUID, groups by a 32 byte id.
+    if (!(conversationId instanceof Buffer) ||
+        (conversationId.byteLength !== 16 && conversationId.byteLength !== 32)) {
+        throw new TypeError('Invalid conversation id');
+    }
+}
+
+
+function deriveConversationMetaKey(masterKey, conversationId) {
+    assertKey(masterKey, 'master key');
+    assertConversationId(conversationId);
+    const info = Buffer.concat([Buffer.from(CONVERSATION_META_KEY_INFO), conversationId]);
+    return crypto.deriveSecrets(masterKey, Buffer.alloc(32), info, 1)[0];
+}
+
+
+// Local drafts: HKDF(storageKey, salt = 0 * 32, info = "WhisperDraft" || conversationId),
+// separate from the storage service keys derived from the same storage key.
+function deriveDraftKey(storageKey, conversationId) {
+    assertKey(storageKey, 'storage key');
+    assertConversationId(conversationId);
+    const info = Buffer.concat([Buffer.from(DRAFT_KEY_INFO), conversationId]);
+    return crypto.deriveSecrets(storageKey, Buffer.alloc(32), info, 1)[0];
+}
+
+
+/*
+ * Every session gets its own 4 byte prefix from its root key, so two sessions
+ * that share a GCM key and count nonces from zero only reuse a (key, nonce)
+ * pair if their prefixes collide.  Prefixes are effectively random, so among n
+ * such sessions that happens with probability about n^2 / 2^33.  That is
+ * already likely at around 2^16 sessions per key, so don't rely on the prefix
+ * alone when many sessions share one key.  The full 12 byte nonce is
+ * deriveNonce(prefix, counter) = prefix || uint64 BE counter.
+ */
+function deriveSessionNoncePrefix(rootKey) {
+    assertKey(rootKey, 'root key');
+    const secrets = crypto.deriveSecrets(rootKey, Buffer.alloc(32), Buffer.from(NONCE_PREFIX_INFO), 1);
+    return secrets[0].subarray(0, 4);
+}
+
+
+function deriveNonce(prefix, counter) {
+    assertKey(prefix, 'nonce prefix', 4);
+    if (!Number.isSafeInteger(counter) || counter < 0) {
+        throw new RangeError('Invalid nonce counter: ' + counter);
+    }
+    const nonce = Buffer.alloc(12);
+    nonce.set(prefix);
+    nonce.writeBigUInt64BE(BigInt(counter), 4);
+    return nonce;
+}
+
+/*
+ * SHA-256(label || rootKey).  Safe to exchange in the clear: both sides compare
+ * commitments to spot a handshake that derived different root keys.
+ */
+function rootKeyCommitment(rootKey) {
+    assertKey(rootKey, 'root key');
+    return nodeCrypto.createHash('sha256')
+        .update(ROOT_KEY_COMMITMENT_LABEL)
+        .update(rootKey)
+        .digest();
+}
+
+
+function verifyRootKeyCommitment(rootKey, commitment) {
+    if (!(commitment instanceof Buffer) || commitment.byteLength !== 32) {
+        return false;
+    }
+    return nodeCrypto.timingSafeEqual(rootKeyCommitment(rootKey), commitment);
+}
+
+/*
+ * Fan-out to a recipient's devices: each device gets its own key from the one
+ * shared message key (info = label || uint32 BE deviceId), so the payload is
+ * encrypted once and only the key differs per device.
+ */
+function deriveDeviceMessageKey(messageKey, deviceId) {
+    assertKey(messageKey, 'message key');
+    if (!Number.isInteger(deviceId) || deviceId < 1 || deviceId > MAX_DEVICE_ID) {
+        throw new RangeError('Invalid device id: ' + deviceId);
+    }
+    const info = Buffer.alloc(DEVICE_MESSAGE_KEY_INFO.length + 4);
+    info.write(DEVICE_MESSAGE_KEY_INFO);
+    info.writeUInt32BE(deviceId, DEVICE_MESSAGE_KEY_INFO.length);
+    return crypto.deriveSecrets(messageKey, Buffer.alloc(32), info, 1)[0];
+}
+
+/*
+ * Key for sync messages to one of our own linked devices.  All of a user's
+ * devices hold the identity key, so each can compute
+ *
+ *   HKDF(ECDH(identityPriv, identityPub), salt = 0 * 32,
+ *        info = "WhisperSyncMessageKey" || uint32 BE deviceId)[0:32]
+ *
+ * and agree on it without another exchange.
+ */
+function deriveSyncMessageKey(selfIdentityPrivKey, targetDeviceId) {
+    if (!Number.isInteger(targetDeviceId) || targetDeviceId < 1 ||
+        targetDeviceId > MAX_DEVICE_ID) {
+        throw new RangeError('Invalid device id: ' + targetDeviceId);
+    }
+    const {pubKey} = curve.createKeyPair(selfIdentityPrivKey);
+    const secret = curve.calculateAgreement(pubKey, selfIdentityPrivKey);
+    const info = Buffer.alloc(SYNC_MESSAGE_KEY_INFO.length + 4);
+    info.write(SYNC_MESSAGE_KEY_INFO);
+    info.writeUInt32BE(targetDeviceId, SYNC_MESSAGE_KEY_INFO.length);
+    return crypto.deriveSecrets(secret, Buffer.alloc(32), info, 1)[0];
+}
+
+function deriveLinkPreviewKey(messageKey) {
+    assertKey(messageKey, 'message key');
+    return crypto.deriveSecrets(messageKey, Buffer.alloc(32), Buffer.from(LINK_PREVIEW_KEY_INFO), 1)[0];
+}
+
+/*
+ * The two Double Ratchet KDF steps, exactly as SessionCipher performs them:
+ *
+ *   KDF_RK: HKDF(dhOutput, salt = rootKey, info = "WhisperRatchet") -> rootKey, chainKey
+ *   KDF_CK: messageKey = HMAC(chainKey, 0x01), chainKey = HMAC(chainKey, 0x02)
+ *
+ * messageKey is the seed that is expanded with "WhisperMessageKeys" into the
+ * cipher key, MAC key and IV.
+ */
+function kdfRootKey(rootKey, dhOutput) {
+    assertKey(rootKey, 'root key');
+    assertKey(dhOutput, 'DH output');
+    const [newRootKey, chainKey] = crypto.deriveSecrets(dhOutput, rootKey,
+                                                        Buffer.from(RATCHET_INFO), 2);
+    return {rootKey: newRootKey, chainKey};
+}
+
+function kdfChainKey(chainKey) {
+    assertKey(chainKey, 'chain key');
+    return {
+        chainKey: crypto.calculateMAC(chainKey, Buffer.from([2])),
+        messageKey: crypto.calculateMAC(chainKey, Buffer.from([1]))
+    };
+}
+
+module.exports = {
+    deriveConversationMetaKey,
+    deriveDeviceMessageKey,
+    deriveDraftKey,
+    deriveLinkPreviewKey,
+    deriveNonce,
+    deriveSessionNoncePrefix,
+    deriveStorageItemKey,
+    deriveStorageKeys,
+    deriveStorageManifestKey,
+    deriveSyncMessageKey,
+    deriveTypingKey,
+    kdfChainKey,
+    kdfRootKey,
+    rootKeyCommitment,
+    verifyRootKeyCommitment
+};
@@ -0,0 +1,95 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const nodeCrypto = require('crypto');
+const {Reader, Writer} = require('protobufjs/minimal');
+
+/*
+ * Linked device names use the same construction as the official clients so a
+ * name set here shows up correctly everywhere else:
+ *
+ *   masterSecret = ECDH(ephemeral, identity)
+ *   syntheticIv  = HMAC(HMAC(masterSecret, "auth"), name)[0:16]
+ *   cipherKey    = HMAC(HMAC(masterSecret, "cipher"), syntheticIv)
+ *   ciphertext   = AES-256-CTR(cipherKey, counter = 0, name)
+ *
+ * The result is the DeviceName protobuf { ephemeralPublic = 1, syntheticIv = 2,
+ * ciphertext = 3 }.
+ */
+
+const utf8Decoder = new TextDecoder('utf-8', {fatal: true});
+
+
+function deriveCipherKey(masterSecret, syntheticIv) {
+    const key = crypto.calculateMAC(masterSecret, Buffer.from('cipher'));
+    return crypto.calculateMAC(key, syntheticIv);
+}
+
+function computeSyntheticIv(masterSecret, plaintext) {
+    const key = crypto.calculateMAC(masterSecret, Buffer.from('auth'));
+    return crypto.calculateMAC(key, plaintext).subarray(0, 16);
+}
+
+function aesCtr(key, data) {
+    const cipher = nodeCrypto.createCipheriv('aes-256-ctr', key, Buffer.alloc(16));
+    return Buffer.concat([cipher.update(data), cipher.final()]);
+}
+
+
+function encryptDeviceName(identityPubKey, name) {
+    if (typeof name !== 'string') {
+        throw new TypeError('name must be a string');
+    }
+    const plaintext = Buffer.from(name, 'utf8');
+    const ephemeral = curve.generateKeyPair();
+    const masterSecret = curve.calculateAgreement(identityPubKey, ephemeral.privKey);
+    const syntheticIv = computeSyntheticIv(masterSecret, plaintext);
+    const ciphertext = aesCtr(deriveCipherKey(masterSecret, syntheticIv), plaintext);
+    return Buffer.from(Writer.create()
+        .uint32(10).bytes(ephemeral.pubKey)
+        .uint32(18).bytes(syntheticIv)
+        .uint32(26).bytes(ciphertext)
+        .finish());
+}
+
+
+function decryptDeviceName(identityPrivKey, deviceName) {
+    if (!(deviceName instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${deviceName?.constructor?.name}`);
+    }
+    const reader = Reader.create(deviceName);
+    let ephemeralPublic, syntheticIv, ciphertext;
+    while (reader.pos < reader.len) {
+        const tag = reader.uint32();
+        switch (tag >>> 3) {
+            case 1:
+                ephemeralPublic = Buffer.from(reader.bytes());
+                break;
+            case 2:
+                syntheticIv = Buffer.from(reader.bytes());
+                break;
+            case 3:
+                ciphertext = Buffer.from(reader.bytes());
+                break;
+            default:
+                reader.skipType(tag & 7);
+        }
+    }
+    if (!ephemeralPublic || !syntheticIv || syntheticIv.byteLength !== 16 || !ciphertext) {
+        throw new Error('Invalid device name');
+    }
+    const masterSecret = curve.calculateAgreement(ephemeralPublic, identityPrivKey);
+    const plaintext = aesCtr(deriveCipherKey(masterSecret, syntheticIv), ciphertext);
+    if (!nodeCrypto.timingSafeEqual(computeSyntheticIv(masterSecret, plaintext), syntheticIv)) {
+        throw new Error('Device name failed authentication');
+    }
+    return utf8Decoder.decode(plaintext);
+}
+
+module.exports = {
+    decryptDeviceName,
+    encryptDeviceName
+};
@@ -0,0 +1,64 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * Disappearing message timers at rest:
+ *
+ *   timerKey = HKDF(conversationKey, salt = 0 * 32, info = "WhisperTimerKey")[0:32]
+ *   envelope = nonce (12, random) || AES-256-GCM(timerKey, nonce, uint32 BE seconds)
+ *
+ * The envelope is always 12 + 4 + 16 = 32 bytes.
+ */
+const TIMER_KEY_INFO = 'WhisperTimerKey';
+const NONCE_LENGTH = 12;
+const ENVELOPE_LENGTH = NONCE_LENGTH + 4 + 16;
+
+
+function assertKey(key, name) {
+    if (!(key instanceof Buffer) || key.byteLength !== 32) {
+        throw new TypeError(`${name} must be a 32 byte Buffer`);
+    }
+}
+
+
+function deriveTimerKey(conversationKey) {
+    assertKey(conversationKey, 'Conversation key');
+    return crypto.deriveSecrets(conversationKey, Buffer.alloc(32), Buffer.from(TIMER_KEY_INFO), 1)[0];
+}
+
+
+function encryptTimer(timerKey, seconds) {
+    assertKey(timerKey, 'Timer key');
+    if (!Number.isInteger(seconds) || seconds < 0 || seconds > 0xffffffff) {
+        throw new RangeError('Invalid timer: ' + seconds);
+    }
+    const plaintext = Buffer.alloc(4);
+    plaintext.writeUInt32BE(seconds);
+    const nonce = nodeCrypto.randomBytes(NONCE_LENGTH);
+    return Buffer.concat([nonce, crypto.aesGcmEncrypt(timerKey, nonce, plaintext)]);
+}
+
+
+function decryptTimer(timerKey, envelope) {
+    assertKey(timerKey, 'Timer key');
+    if (!(envelope instanceof Buffer)) {
+        throw new TypeError('Envelope must be a Buffer');
+    }
+    if (envelope.byteLength !== ENVELOPE_LENGTH) {
+        throw new errors.AuthenticationError('Authentication failed');
+    }
+    const plaintext = crypto.aesGcmDecrypt(timerKey, envelope.subarray(0, NONCE_LENGTH),
+                                           envelope.subarray(NONCE_LENGTH));
+    return plaintext.readUInt32BE(0);
+}
+
+module.exports = {
+    decryptTimer,
+    deriveTimerKey,
+    encryptTimer
+};
@@ -0,0 +1,73 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * envelope = body || mac, where body is the AES-256-CBC ciphertext under the
+ * keys SessionCipher derives from the message key and mac is the first 8 bytes
+ * of HMAC-SHA256(macKey, versionByte || body).
+ */
+const MAC_LENGTH = 8;
+const whisperMsgKeys = 'WhisperMessageKeys';
+
+
+function assertArgs(macKey, messageKey, versionByte) {
+    if (!(macKey instanceof Buffer) || macKey.byteLength !== 32) {
+        throw new TypeError('macKey must be a 32 byte Buffer');
+    }
+    if (!(messageKey instanceof Buffer) || messageKey.byteLength !== 32) {
+        throw new TypeError('messageKey must be a 32 byte Buffer');
+    }
+    if (!Number.isInteger(versionByte) || versionByte < 0 || versionByte > 0xff) {
+        throw new RangeError('Invalid version byte: ' + versionByte);
+    }
+}
+
+function computeMac(macKey, versionByte, body) {
+    return crypto.calculateMAC(macKey, Buffer.concat([Buffer.from([versionByte]), body]))
+        .subarray(0, MAC_LENGTH);
+}
+
+function deriveKeys(messageKey) {
+    const keys = crypto.deriveSecrets(messageKey, Buffer.alloc(32), Buffer.from(whisperMsgKeys));
+    return {cipherKey: keys[0], iv: keys[2].subarray(0, 16)};
+}
+
+
+function buildEnvelope(macKey, messageKey, versionByte, plaintext) {
+    assertArgs(macKey, messageKey, versionByte);
+    const {cipherKey, iv} = deriveKeys(messageKey);
+    const body = crypto.encrypt(cipherKey, plaintext, iv);
+    return Buffer.concat([body, computeMac(macKey, versionByte, body)]);
+}
+
+
+function receiveMessage(macKey, messageKey, versionByte, envelope) {
+    assertArgs(macKey, messageKey, versionByte);
+    if (!(envelope instanceof Buffer) || envelope.byteLength <= MAC_LENGTH) {
+        throw new errors.MacError('Envelope too short');
+    }
+    const body = envelope.subarray(0, -MAC_LENGTH);
+    const mac = envelope.subarray(-MAC_LENGTH);
+    if (!nodeCrypto.timingSafeEqual(computeMac(macKey, versionByte, body), mac)) {
+        throw new errors.MacError('Bad MAC');
+    }
+    const {cipherKey, iv} = deriveKeys(messageKey);
+    try {
+        return crypto.decrypt(cipherKey, body, iv);
+    } catch (e) {
+        if (e instanceof errors.DecryptionError) {
+            throw e;
+        }
+        throw new errors.DecryptionError('Bad padding');
+    }
+}
+
+module.exports = {
+    buildEnvelope,
+    receiveMessage
+};
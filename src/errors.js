@@ -2,6 +2,27 @@
 
 exports.SignalError = class SignalError extends Error {};
 
+// Stable, machine readable codes carried as error.code, for callers that need
+// to branch on (or localize) a failure without matching on the message.
+exports.ErrorCode = Object.freeze({
+    AUTH_FAILED: 'auth_failed',
+    EMPTY_MESSAGE: 'empty_message',
+    INVALID_PRIVATE_KEY: 'invalid_private_key',
+    INVALID_PUBLIC_KEY: 'invalid_public_key',
+    INVALID_RANDOM: 'invalid_random',
+    INVALID_SHARED_SECRET: 'invalid_shared_secret',
+    INVALID_SIGNATURE: 'invalid_signature'
+});
+
+// Bad input to the curve functions; code is one of ErrorCode.
+exports.CurveError = class CurveError extends exports.SignalError {
+    constructor(code, message) {
+        super(message);
+        this.name = 'CurveError';
+        this.code = code;
+    }
+};
+
 exports.UntrustedIdentityKeyError = class UntrustedIdentityKeyError extends exports.SignalError {
     constructor(addr, identityKey) {
         super();
@@ -31,3 +52,50 @@ exports.PreKeyError = class PreKeyError extends exports.SessionError {
         this.name = 'PreKeyError';
     }
 };
+
+exports.SignatureError = class SignatureError extends exports.SignalError {
+    constructor(message) {
+        super(message);
+        this.name = 'SignatureError';
+    }
+};
+
+exports.DecryptionError = class DecryptionError extends exports.SignalError {
+    constructor(message) {
+        super(message);
+        this.name = 'DecryptionError';
+    }
+};
+
+exports.MessageFormatError = class MessageFormatError extends exports.SignalError {
+    constructor(message) {
+        super(message);
+        this.name = 'MessageFormatError';
+    }
+};
+
+exports.MacError = class MacError extends exports.SignalError {
+    constructor(message) {
+        super(message);
+        this.name = 'MacError';
+    }
+};
+
+// AEAD tag mismatch.  Every failure to open gets this same error, whatever the
+// cause, so callers can't learn more than "didn't authenticate".
+exports.AuthenticationError = class AuthenticationError extends exports.DecryptionError {
+    constructor(message) {
+        super(message);
+        this.name = 'AuthenticationError';
+        this.code = exports.ErrorCode.AUTH_FAILED;
+    }
+};
+
+exports.InsufficientRoleError = class InsufficientRoleError extends exports.SignalError {
+    constructor(memberRole, requiredRole) {
+        super(`Role ${memberRole} is below the required role ${requiredRole}`);
+        this.name = 'InsufficientRoleError';
+        this.memberRole = memberRole;
+        this.requiredRole = requiredRole;
+    }
+};
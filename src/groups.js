@@ -0,0 +1,212 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * Avatar palette shared by every client.  Only append to this list; reordering
+ * or removing entries changes the color every member sees for existing groups.
+ */
+const AVATAR_COLORS = [
+    'A100', 'A110', 'A120', 'A130', 'A140', 'A150',
+    'A160', 'A170', 'A180', 'A190', 'A200', 'A210'
+];
+
+const GROUP_COLOR_LABEL = 'GroupAvatarColor';
+const MEMBER_COLOR_LABEL = 'GroupMemberColor';
+const SENDER_KEY_ID_LABEL = 'GroupSenderKeyIds';
+const MAX_GROUP_MEMBERS = 1000;
+
+/*
+ * Library local group key set, all from one HKDF call over the master key:
+ *
+ *   HKDF(masterKey, salt = 0 * 32, info = "LibSignalGroupKeys")
+ *       -> groupId (32) | accessKey (32) | encryptionKey (32)
+ *
+ * These are NOT the keys the Signal service and official clients use.  They
+ * derive group params from the master key through zkgroup's GroupSecretParams
+ * (an HMAC-SHA256 based sponge plus Ristretto key pairs).  The names carry
+ * "Local" so the ids can't be mistaken for server group ids.  They only match
+ * other users of this library.
+ */
+const GROUP_KEYS_INFO = 'LibSignalGroupKeys';
+
+/*
+ * Encrypted member entries: plaintext = uuid (16) || role (1), sealed with
+ * AES-256-GCM under the group encryption key and a synthetic nonce
+ *
+ *   nonce = HMAC(HMAC(encryptionKey, "GroupMemberNonce"), plaintext)[0:12]
+ *
+ * output = nonce || ciphertext || tag.  The nonce covers the role as well as
+ * the uuid, so re-encrypting a member with a new role never reuses a nonce,
+ * while the same entry always encrypts to the same bytes.
+ */
+const MEMBER_NONCE_LABEL = 'GroupMemberNonce';
+const MEMBER_NONCE_LENGTH = 12;
+
+
+function assertMasterKey(groupMasterKey) {
+    if (!(groupMasterKey instanceof Buffer)) {
+        throw new TypeError(`Invalid group master key type: ${groupMasterKey?.constructor?.name}`);
+    }
+    if (groupMasterKey.byteLength !== 32) {
+        throw new Error(`Incorrect group master key length: ${groupMasterKey.byteLength}`);
+    }
+}
+
+
+function deriveGroupColor(groupMasterKey) {
+    assertMasterKey(groupMasterKey);
+    const mac = crypto.calculateMAC(groupMasterKey, Buffer.from(GROUP_COLOR_LABEL));
+    return mac.readUInt32BE(0) % AVATAR_COLORS.length;
+}
+
+/*
+ * Per-member indexes into AVATAR_COLORS.  Each member's preferred color is
+ * HMAC(masterKey, label || uuid) mod 12.  Members are then placed in uuid
+ * order, each taking the first free color from its preferred one onwards.
+ * Once all 12 are taken the palette starts over.  No two members share a color
+ * until the group outgrows the palette, and every client gets the same answer
+ * whatever order it lists the members in.  Results follow the input order.
+ */
+function deriveMemberColors(groupMasterKey, memberUuids) {
+    assertMasterKey(groupMasterKey);
+    if (!Array.isArray(memberUuids) ||
+        !memberUuids.every(x => x instanceof Buffer && x.byteLength === 16)) {
+        throw new TypeError('memberUuids must be an array of 16 byte Buffers');
+    }
+    const colors = new Map();
+    const sorted = Array.from(new Set(memberUuids.map(x => x.toString('hex')))).sort();
+    let used = new Set();
+    for (const uuid of sorted) {
+        if (used.size === AVATAR_COLORS.length) {
+            used = new Set();
+        }
+        const mac = crypto.calculateMAC(groupMasterKey,
+            Buffer.concat([Buffer.from(MEMBER_COLOR_LABEL), Buffer.from(uuid, 'hex')]));
+        let color = mac.readUInt32BE(0) % AVATAR_COLORS.length;
+        while (used.has(color)) {
+            color = (color + 1) % AVATAR_COLORS.length;
+        }
+        used.add(color);
+        colors.set(uuid, color);
+    }
+    return memberUuids.map(x => colors.get(x.toString('hex')));
+}
+
+/*
+ * Splits the 32 bit key id space into memberCount equally sized ranges.  The
+ * first range starts at an offset taken from HMAC(groupId, label) and member i
+ * (in the group's agreed member order) owns
+ * [start + i * size, start + (i + 1) * size) modulo 2^32.
+ */
+function allocateSenderKeyIds(groupId, memberCount) {
+    if (!(groupId instanceof Buffer) || !groupId.byteLength) {
+        throw new TypeError('Invalid group id');
+    }
+    if (!Number.isInteger(memberCount) || memberCount < 1 || memberCount > MAX_GROUP_MEMBERS) {
+        throw new RangeError('Invalid member count: ' + memberCount);
+    }
+    const offset = crypto.calculateMAC(groupId, Buffer.from(SENDER_KEY_ID_LABEL)).readUInt32BE(0);
+    const size = Math.floor(0x100000000 / memberCount);
+    const ranges = [];
+    for (let i = 0; i < memberCount; i++) {
+        ranges.push({
+            start: (offset + i * size) % 0x100000000,
+            size
+        });
+    }
+    return ranges;
+}
+
+function deriveLocalGroupKeys(groupMasterKey) {
+    assertMasterKey(groupMasterKey);
+    const [groupId, accessKey, encryptionKey] = crypto.deriveSecrets(groupMasterKey,
+        Buffer.alloc(32), Buffer.from(GROUP_KEYS_INFO), 3);
+    return {masterKey: groupMasterKey, groupId, accessKey, encryptionKey};
+}
+
+
+function createLocalGroupKeys() {
+    return deriveLocalGroupKeys(nodeCrypto.randomBytes(32));
+}
+
+function assertEncryptionKey(groupEncryptionKey) {
+    if (!(groupEncryptionKey instanceof Buffer) || groupEncryptionKey.byteLength !== 32) {
+        throw new TypeError('Group encryption key must be a 32 byte Buffer');
+    }
+}
+
+function memberNonce(groupEncryptionKey, plaintext) {
+    const nonceKey = crypto.calculateMAC(groupEncryptionKey, Buffer.from(MEMBER_NONCE_LABEL));
+    return crypto.calculateMAC(nonceKey, plaintext).subarray(0, MEMBER_NONCE_LENGTH);
+}
+
+
+function encryptGroupMember(groupEncryptionKey, memberUuid, role) {
+    assertEncryptionKey(groupEncryptionKey);
+    if (!(memberUuid instanceof Buffer) || memberUuid.byteLength !== 16) {
+        throw new TypeError('Member uuid must be 16 bytes');
+    }
+    if (!Number.isInteger(role) || role < 0 || role > 0xff) {
+        throw new RangeError('Invalid role: ' + role);
+    }
+    const plaintext = Buffer.concat([memberUuid, Buffer.from([role])]);
+    const nonce = memberNonce(groupEncryptionKey, plaintext);
+    return Buffer.concat([nonce, crypto.aesGcmEncrypt(groupEncryptionKey, nonce, plaintext)]);
+}
+
+
+function decryptGroupMember(groupEncryptionKey, encryptedMember) {
+    assertEncryptionKey(groupEncryptionKey);
+    if (!(encryptedMember instanceof Buffer)) {
+        throw new TypeError('Encrypted member must be a Buffer');
+    }
+    if (encryptedMember.byteLength !== MEMBER_NONCE_LENGTH + 17 + 16) {
+        throw new errors.AuthenticationError('Authentication failed');
+    }
+    const nonce = encryptedMember.subarray(0, MEMBER_NONCE_LENGTH);
+    const plaintext = crypto.aesGcmDecrypt(groupEncryptionKey, nonce,
+                                           encryptedMember.subarray(MEMBER_NONCE_LENGTH));
+    if (!nonce.equals(memberNonce(groupEncryptionKey, plaintext))) {
+        throw new errors.AuthenticationError('Authentication failed');
+    }
+    return {memberUuid: plaintext.subarray(0, 16), role: plaintext[16]};
+}
+
+/*
+ * Checks a signed group change.  A bad signature gives false; a good signature
+ * from a member whose role is below requiredRole throws InsufficientRoleError,
+ * so an authorization failure can't be mistaken for a forgery.  Roles compare
+ * numerically, higher meaning more privileged.
+ */
+function verifyGroupChange(memberIdentityPubKey, change, signature, memberRole, requiredRole) {
+    for (const role of [memberRole, requiredRole]) {
+        if (!Number.isInteger(role) || role < 0) {
+            throw new RangeError('Invalid role: ' + role);
+        }
+    }
+    if (!curve.verifySignature(memberIdentityPubKey, change, signature)) {
+        return false;
+    }
+    if (memberRole < requiredRole) {
+        throw new errors.InsufficientRoleError(memberRole, requiredRole);
+    }
+    return true;
+}
+
+module.exports = {
+    AVATAR_COLORS,
+    allocateSenderKeyIds,
+    createLocalGroupKeys,
+    decryptGroupMember,
+    deriveGroupColor,
+    deriveLocalGroupKeys,
+    deriveMemberColors,
+    encryptGroupMember,
+    verifyGroupChange
+};
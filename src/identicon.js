@@ -0,0 +1,57 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const nodeCrypto = require('crypto');
+
+/*
+ * Classic 5x5 mirrored identicon.  SHA-256 over the 32 byte identity key picks
+ * the 15 cells of the left three columns (mirrored onto the right two) and the
+ * foreground gray level; the background is white.  Output is one 8 bit gray
+ * pixel per byte, row major, size x size.
+ */
+const GRID = 5;
+const MIN_SIZE = GRID;
+const MAX_SIZE = 1024;
+const BACKGROUND = 0xff;
+
+
+function generateIdenticon(identityPubKey, size) {
+    if (!(identityPubKey instanceof Buffer) ||
+        (identityPubKey.byteLength !== 32 &&
+         (identityPubKey.byteLength !== 33 || identityPubKey[0] !== 5))) {
+        throw new Error('Invalid public key');
+    }
+    if (!Number.isInteger(size) || size < MIN_SIZE || size > MAX_SIZE) {
+        throw new RangeError('Invalid identicon size: ' + size);
+    }
+    const key = identityPubKey.byteLength === 33 ? identityPubKey.subarray(1) : identityPubKey;
+    const digest = nodeCrypto.createHash('sha256').update(key).digest();
+    // Keep the foreground dark enough to stand out from the background.
+    const foreground = digest[0] % 0xb0;
+    const cells = [];
+    for (let row = 0; row < GRID; row++) {
+        for (let col = 0; col < GRID; col++) {
+            const bit = row * 3 + Math.min(col, GRID - 1 - col);
+            cells.push((digest[1 + (bit >> 3)] >> (bit & 7)) & 1);
+        }
+    }
+    const pixels = Buffer.alloc(size * size, BACKGROUND);
+    for (let y = 0; y < size; y++) {
+        const row = Math.floor(y * GRID / size);
+        for (let x = 0; x < size; x++) {
+            if (cells[row * GRID + Math.floor(x * GRID / size)]) {
+                pixels[y * size + x] = foreground;
+            }
+        }
+    }
+    return {
+        width: size,
+        height: size,
+        pixels
+    };
+}
+
+module.exports = {
+    generateIdenticon
+};
@@ -0,0 +1,87 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const TrustLevel = require('./trust_level');
+
+/*
+ * Serialized layout (all integers big endian):
+ *
+ *   version (1) | identityKey (33) | registrationId (4) | trustLevel (1) | firstSeen (8)
+ *
+ * Bump IDENTITY_RECORD_VERSION and teach parseIdentityRecord the old layout
+ * whenever fields change so stored trust data keeps loading.
+ */
+const IDENTITY_RECORD_VERSION = 1;
+const IDENTITY_RECORD_LENGTH = 1 + 33 + 4 + 1 + 8;
+const MAX_REGISTRATION_ID = 0x3fff;
+
+const trustLevels = new Set(Object.values(TrustLevel));
+
+
+function assertIdentityKey(identityKey) {
+    if (!(identityKey instanceof Buffer)) {
+        throw new TypeError(`Invalid identity key type: ${identityKey?.constructor?.name}`);
+    }
+    if (identityKey.byteLength !== 33 || identityKey[0] !== 5) {
+        throw new Error('Invalid identity key');
+    }
+}
+
+function assertFields(registrationId, trustLevel, firstSeen) {
+    if (!Number.isInteger(registrationId) || registrationId < 0 ||
+        registrationId > MAX_REGISTRATION_ID) {
+        throw new RangeError('Invalid registrationId: ' + registrationId);
+    }
+    if (!trustLevels.has(trustLevel)) {
+        throw new RangeError('Invalid trustLevel: ' + trustLevel);
+    }
+    if (!Number.isSafeInteger(firstSeen) || firstSeen < 0) {
+        throw new RangeError('Invalid firstSeen: ' + firstSeen);
+    }
+}
+
+
+function buildIdentityRecord(identityKey, registrationId, trustLevel, firstSeen) {
+    assertIdentityKey(identityKey);
+    assertFields(registrationId, trustLevel, firstSeen);
+    const record = Buffer.alloc(IDENTITY_RECORD_LENGTH);
+    record[0] = IDENTITY_RECORD_VERSION;
+    record.set(identityKey, 1);
+    record.writeUInt32BE(registrationId, 34);
+    record[38] = trustLevel;
+    record.writeBigUInt64BE(BigInt(firstSeen), 39);
+    return record;
+}
+
+
+function parseIdentityRecord(record) {
+    if (!(record instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${record?.constructor?.name}`);
+    }
+    if (!record.byteLength || record[0] !== IDENTITY_RECORD_VERSION) {
+        throw new Error('Unsupported identity record version: ' + record[0]);
+    }
+    if (record.byteLength !== IDENTITY_RECORD_LENGTH) {
+        throw new Error('Incorrect identity record length: ' + record.byteLength);
+    }
+    const identityKey = Buffer.from(record.subarray(1, 34));
+    const registrationId = record.readUInt32BE(34);
+    const trustLevel = record[38];
+    const firstSeen = Number(record.readBigUInt64BE(39));
+    assertIdentityKey(identityKey);
+    assertFields(registrationId, trustLevel, firstSeen);
+    return {
+        identityKey,
+        registrationId,
+        trustLevel,
+        firstSeen
+    };
+}
+
+module.exports = {
+    IDENTITY_RECORD_VERSION,
+    TrustLevel,
+    buildIdentityRecord,
+    parseIdentityRecord
+};
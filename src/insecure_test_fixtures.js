@@ -0,0 +1,48 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+/*
+ * INSECURE: everything here is derived from a public label, so anyone who knows
+ * the label has the private keys.  These fixtures exist so tests and demos can
+ * share reproducible identities; never use them for a real account.
+ */
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+
+const FIXTURE_INFO = 'LibSignalInsecureTestIdentity';
+const SIGNED_PRE_KEY_ID = 1;
+
+
+function clamp(key) {
+    key[0] &= 248;
+    key[31] &= 127;
+    key[31] |= 64;
+    return key;
+}
+
+
+function deterministicIdentity(label) {
+    if (typeof label !== 'string' || !label.length) {
+        throw new TypeError('label must be a non-empty string');
+    }
+    const [identitySeed, preKeySeed, registrationSeed] = crypto.deriveSecrets(
+        Buffer.from(label, 'utf8'), Buffer.alloc(32), Buffer.from(FIXTURE_INFO));
+    const identityKeyPair = curve.createKeyPair(clamp(identitySeed));
+    const preKeyPair = curve.createKeyPair(clamp(preKeySeed));
+    return {
+        identityKeyPair,
+        registrationId: (registrationSeed.readUInt16BE(0) & 0x3fff) || 1,
+        signedPreKey: {
+            keyId: SIGNED_PRE_KEY_ID,
+            keyPair: preKeyPair,
+            // Signing is deterministic, so the signature is reproducible too.
+            signature: curve.calculateSignature(identityKeyPair.privKey, preKeyPair.pubKey)
+        }
+    };
+}
+
+module.exports = {
+    deterministicIdentity
+};
@@ -0,0 +1,10 @@
+'use strict';
+
+const curve = require('./curve');
+const {parentPort, workerData} = require('worker_threads');
+
+const keyPairs = [];
+for (let i = 0; i < workerData.count; i++) {
+    keyPairs.push(curve.generateKeyPair());
+}
+parentPort.postMessage(keyPairs);
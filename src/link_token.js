@@ -0,0 +1,63 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const errors = require('./errors');
+
+/*
+ * The QR code shown when linking a new device:
+ *
+ *   sgnl://linkdevice?uuid=<provisioning address>&pub_key=<base64url key>
+ *
+ * pub_key is the 33 byte (0x05 prefixed) ephemeral public key of the new
+ * device and uuid the provisioning socket address it is waiting on.  Parameters
+ * are always emitted in this order so the same inputs give the same string.
+ */
+
+const LINK_SCHEME = 'sgnl:';
+const LINK_HOST = 'linkdevice';
+
+
+function assertEphemeralKey(pubKey) {
+    if (!(pubKey instanceof Buffer) || pubKey.byteLength !== 33 || pubKey[0] !== 5) {
+        throw new errors.MessageFormatError('Invalid ephemeral public key');
+    }
+}
+
+
+function buildLinkToken(ephemeralPubKey, uuid) {
+    assertEphemeralKey(ephemeralPubKey);
+    if (typeof uuid !== 'string' || !uuid) {
+        throw new errors.MessageFormatError('Invalid provisioning uuid');
+    }
+    const params = new URLSearchParams();
+    params.set('uuid', uuid);
+    params.set('pub_key', ephemeralPubKey.toString('base64url'));
+    return `${LINK_SCHEME}//${LINK_HOST}?${params}`;
+}
+
+
+function parseLinkToken(url) {
+    let parsed;
+    try {
+        parsed = new URL(url);
+    } catch (e) {
+        throw new errors.MessageFormatError('Malformed link token');
+    }
+    if (parsed.protocol !== LINK_SCHEME || parsed.host !== LINK_HOST) {
+        throw new errors.MessageFormatError('Not a device link token');
+    }
+    const uuid = parsed.searchParams.get('uuid');
+    const encodedKey = parsed.searchParams.get('pub_key');
+    if (!uuid || !encodedKey || !/^[A-Za-z0-9_-]+$/.test(encodedKey)) {
+        throw new errors.MessageFormatError('Malformed link token');
+    }
+    const ephemeralPubKey = Buffer.from(encodedKey, 'base64url');
+    assertEphemeralKey(ephemeralPubKey);
+    return {ephemeralPubKey, uuid};
+}
+
+module.exports = {
+    buildLinkToken,
+    parseLinkToken
+};
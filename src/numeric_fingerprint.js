@@ -1,22 +1,23 @@
 
 const crypto = require('./crypto.js');
+const nodeCrypto = require('crypto');
 
 var VERSION = 0;
 
 
-async function iterateHash(data, key, count) {
-    const combined = (new Uint8Array(Buffer.concat([data, key]))).buffer;
-    const result = crypto.hash(combined);
-    if (--count === 0) {
-        return result;
-    } else {
-        return iterateHash(result, key, count);
+function iterateHash(data, key, count) {
+    let result = data;
+    for (let i = 0; i < count; i++) {
+        result = crypto.hash(Buffer.concat([result, key]));
     }
+    return result;
 }
 
 
-function shortToArrayBuffer(number) {
-    return new Uint16Array([number]).buffer;
+function shortToBuffer(number) {
+    const buffer = Buffer.alloc(2);
+    buffer.writeUInt16BE(number);
+    return buffer;
 }
 
 function getEncodedChunk(hash, offset) {
@@ -32,14 +33,13 @@ function getEncodedChunk(hash, offset) {
     return s;
 }
 
-async function getDisplayStringFor(identifier, key, iterations) {
+function getDisplayStringFor(identifier, key, iterations) {
     const bytes = Buffer.concat([
-        shortToArrayBuffer(VERSION),
+        shortToBuffer(VERSION),
         key,
         identifier
     ]);
-    const arraybuf = (new Uint8Array(bytes)).buffer;
-    const output = new Uint8Array(await iterateHash(arraybuf, key, iterations));
+    const output = iterateHash(bytes, key, iterations);
     return getEncodedChunk(output, 0) +
         getEncodedChunk(output, 5) +
         getEncodedChunk(output, 10) +
@@ -48,6 +48,35 @@ async function getDisplayStringFor(identifier, key, iterations) {
         getEncodedChunk(output, 25);
 }
 
+/*
+ * The 60 digit safety number, as libsignal's NumericFingerprintGenerator
+ * computes it: each side hashes version (uint16 BE) || identityKey ||
+ * identifier, then iterations rounds of SHA-512(hash || identityKey), and
+ * encodes the first 30 bytes as six 5 digit chunks.  The two halves are
+ * joined in sorted order so both parties see the same number.  Identity keys
+ * are the 33 byte serialized form.
+ */
+exports.generateFingerprint = function(iterations, localIdentifier, localIdentityKey,
+                                       remoteIdentifier, remoteIdentityKey) {
+    if (!Number.isInteger(iterations) || iterations < 1) {
+        throw new Error('Invalid iteration count');
+    }
+    for (const identifier of [localIdentifier, remoteIdentifier]) {
+        if (!(identifier instanceof Buffer)) {
+            throw new Error('Invalid identifier');
+        }
+    }
+    for (const key of [localIdentityKey, remoteIdentityKey]) {
+        if (!(key instanceof Buffer) || key.byteLength !== 33 || key[0] !== 5) {
+            throw new Error('Invalid identity key');
+        }
+    }
+    return [
+        getDisplayStringFor(localIdentifier, localIdentityKey, iterations),
+        getDisplayStringFor(remoteIdentifier, remoteIdentityKey, iterations)
+    ].sort().join('');
+};
+
 exports.FingerprintGenerator = function(iterations) {
     this.iterations = iterations;
 };
@@ -62,11 +91,60 @@ exports.FingerprintGenerator.prototype = {
           throw new Error('Invalid arguments');
         }
 
-        return Promise.all([
-            getDisplayStringFor(localIdentifier, localIdentityKey, this.iterations),
-            getDisplayStringFor(remoteIdentifier, remoteIdentityKey, this.iterations)
-        ]).then(function(fingerprints) {
-            return fingerprints.sort().join('');
-        });
+        return Promise.resolve(exports.generateFingerprint(this.iterations,
+            Buffer.from(localIdentifier), Buffer.from(localIdentityKey),
+            Buffer.from(remoteIdentifier), Buffer.from(remoteIdentityKey)));
+    }
+};
+
+/*
+ * Short display form of a ratchet public key: the first 10 bytes of SHA-256 over
+ * the 32 byte key, in groups of four hex digits.  The 0x05 type byte is dropped
+ * first so 32 and 33 byte forms of a key give the same fingerprint.
+ */
+exports.ratchetKeyFingerprint = function(ratchetPubKey) {
+    if (!(ratchetPubKey instanceof Buffer) ||
+        (ratchetPubKey.byteLength !== 32 &&
+         (ratchetPubKey.byteLength !== 33 || ratchetPubKey[0] !== 5))) {
+        throw new Error('Invalid public key');
+    }
+    const key = ratchetPubKey.byteLength === 33 ? ratchetPubKey.subarray(1) : ratchetPubKey;
+    const digest = nodeCrypto.createHash('sha256').update(key).digest('hex').slice(0, 20);
+    return digest.match(/.{4}/g).join(' ');
+};
+
+/*
+ * Commit/reveal for safety number ceremonies: a party publishes
+ * HMAC-SHA256(nonce, "SafetyNumberCommitment" || digits) first and the
+ * number and nonce afterwards, so nobody can pick their number after seeing
+ * the other one.  Whitespace is ignored so the grouped display form works.
+ */
+const SAFETY_NUMBER_COMMITMENT_LABEL = Buffer.from('SafetyNumberCommitment');
+
+function safetyNumberCommitment(safetyNumber, nonce) {
+    if (typeof safetyNumber !== 'string') {
+        throw new Error('Invalid safety number');
+    }
+    const digits = safetyNumber.replace(/\s/g, '');
+    if (!/^[0-9]{60}$/.test(digits)) {
+        throw new Error('Safety number must be 60 digits');
+    }
+    if (!(nonce instanceof Buffer) || nonce.byteLength < 16) {
+        throw new Error('Nonce must be at least 16 bytes');
+    }
+    return nodeCrypto.createHmac('sha256', nonce)
+        .update(SAFETY_NUMBER_COMMITMENT_LABEL)
+        .update(digits)
+        .digest();
+}
+
+exports.commitSafetyNumber = function(safetyNumber, nonce) {
+    return safetyNumberCommitment(safetyNumber, nonce);
+};
+
+exports.revealSafetyNumber = function(commitment, safetyNumber, nonce) {
+    if (!(commitment instanceof Buffer) || commitment.byteLength !== 32) {
+        return false;
     }
+    return nodeCrypto.timingSafeEqual(commitment, safetyNumberCommitment(safetyNumber, nonce));
 };
@@ -0,0 +1,96 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * PIN based recovery of the 32 byte master key:
+ *
+ *   stretched     = PBKDF2-SHA256(pin, salt, iterations, 64)
+ *   accessKey     = stretched[0:32]    (authenticates to the recovery service)
+ *   encryptionKey = stretched[32:64]   (never leaves the client)
+ *
+ * The service stores svrSecret = iv (16) || ciphertext (32), the master key
+ * sealed with the HMAC synthetic IV scheme:
+ *
+ *   iv         = HMAC(HMAC(encryptionKey, "auth"), masterKey)[0:16]
+ *   ciphertext = masterKey XOR HMAC(HMAC(encryptionKey, "enc"), iv)
+ *
+ * The iv doubles as the MAC, so a wrong PIN is caught on recovery.  PIN
+ * stretching uses PBKDF2 rather than the official clients' Argon2, so backups
+ * made here only round trip with this library.
+ */
+const MASTER_KEY_LENGTH = 32;
+const IV_LENGTH = 16;
+const MAX_PIN_ITERATIONS = 10000000;
+
+
+function derivePinKeys(pin, salt, iterations) {
+    if (typeof pin !== 'string' || !pin.trim()) {
+        throw new TypeError('Invalid PIN');
+    }
+    if (!(salt instanceof Buffer) || salt.byteLength < 16) {
+        throw new TypeError('Salt must be a Buffer of at least 16 bytes');
+    }
+    if (!Number.isInteger(iterations) || iterations < 1 || iterations > MAX_PIN_ITERATIONS) {
+        throw new RangeError('Invalid iteration count: ' + iterations);
+    }
+    const normalized = Buffer.from(pin.trim().normalize('NFKD'), 'utf8');
+    const stretched = nodeCrypto.pbkdf2Sync(normalized, salt, iterations, 64, 'sha256');
+    return {
+        accessKey: stretched.subarray(0, 32),
+        encryptionKey: stretched.subarray(32)
+    };
+}
+
+
+function keystream(encryptionKey, iv) {
+    return crypto.calculateMAC(crypto.calculateMAC(encryptionKey, Buffer.from('enc')), iv);
+}
+
+function syntheticIv(encryptionKey, masterKey) {
+    const authKey = crypto.calculateMAC(encryptionKey, Buffer.from('auth'));
+    return crypto.calculateMAC(authKey, masterKey).subarray(0, IV_LENGTH);
+}
+
+function xor(a, b) {
+    const result = Buffer.alloc(a.length);
+    for (let i = 0; i < a.length; i++) {
+        result[i] = a[i] ^ b[i];
+    }
+    return result;
+}
+
+
+function createPinBackup(pin, masterKey, salt, iterations) {
+    if (!(masterKey instanceof Buffer) || masterKey.byteLength !== MASTER_KEY_LENGTH) {
+        throw new TypeError('Master key must be a 32 byte Buffer');
+    }
+    const {accessKey, encryptionKey} = derivePinKeys(pin, salt, iterations);
+    const iv = syntheticIv(encryptionKey, masterKey);
+    const svrSecret = Buffer.concat([iv, xor(masterKey, keystream(encryptionKey, iv))]);
+    return {accessKey, svrSecret};
+}
+
+
+function recoverMasterKey(pin, svrSecret, salt, iterations) {
+    if (!(svrSecret instanceof Buffer) || svrSecret.byteLength !== IV_LENGTH + MASTER_KEY_LENGTH) {
+        throw new errors.MessageFormatError('Invalid recovery secret');
+    }
+    const {encryptionKey} = derivePinKeys(pin, salt, iterations);
+    const iv = svrSecret.subarray(0, IV_LENGTH);
+    const masterKey = xor(svrSecret.subarray(IV_LENGTH), keystream(encryptionKey, iv));
+    if (!nodeCrypto.timingSafeEqual(iv, syntheticIv(encryptionKey, masterKey))) {
+        throw new errors.MacError('Master key check failed');
+    }
+    return masterKey;
+}
+
+module.exports = {
+    createPinBackup,
+    derivePinKeys,
+    recoverMasterKey
+};
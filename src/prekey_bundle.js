@@ -0,0 +1,105 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const curve = require('./curve');
+const errors = require('./errors');
+
+/*
+ * Accepted server shapes:
+ *
+ *   { identityKey, devices: [{ deviceId, registrationId, signedPreKey, preKey }] }
+ *   { identityKey, deviceId, registrationId, signedPreKey, preKey }
+ *
+ * in camelCase or snake_case, with keys and signatures base64 (standard or URL
+ * safe).  Each device comes out as
+ *
+ *   { deviceId, registrationId, identityKey, signedPreKey: { keyId, publicKey, signature },
+ *     preKey: { keyId, publicKey } | undefined }
+ *
+ * which is exactly what SessionBuilder.initOutgoing takes.
+ */
+
+
+function field(obj, camel, snake) {
+    return obj[camel] !== undefined ? obj[camel] : obj[snake];
+}
+
+function decodeKey(value, name) {
+    if (typeof value !== 'string') {
+        throw new errors.MessageFormatError(`Missing ${name}`);
+    }
+    const key = Buffer.from(value, 'base64');
+    if (key.byteLength !== 33 || key[0] !== 5) {
+        throw new errors.MessageFormatError(`Invalid ${name}`);
+    }
+    return key;
+}
+
+function decodeId(value, name, optional) {
+    if (value === undefined && optional) {
+        return undefined;
+    }
+    if (!Number.isInteger(value) || value < 0 || value > 0xffffffff) {
+        throw new errors.MessageFormatError(`Invalid ${name}: ${value}`);
+    }
+    return value;
+}
+
+function canonicalDevice(identityKey, device) {
+    const rawSigned = field(device, 'signedPreKey', 'signed_pre_key');
+    if (!rawSigned || typeof rawSigned !== 'object') {
+        throw new errors.MessageFormatError('Missing signedPreKey');
+    }
+    const signature = Buffer.from(String(rawSigned.signature), 'base64');
+    if (signature.byteLength !== 64) {
+        throw new errors.MessageFormatError('Invalid signedPreKey signature');
+    }
+    const signedPreKey = {
+        keyId: decodeId(field(rawSigned, 'keyId', 'key_id'), 'signedPreKey keyId'),
+        publicKey: decodeKey(field(rawSigned, 'publicKey', 'public_key'), 'signedPreKey publicKey'),
+        signature
+    };
+    if (!curve.verifySignature(identityKey, signedPreKey.publicKey, signature)) {
+        throw new errors.SignatureError('Invalid signedPreKey signature');
+    }
+    const rawPreKey = field(device, 'preKey', 'pre_key');
+    let preKey;
+    if (rawPreKey) {
+        preKey = {
+            keyId: decodeId(field(rawPreKey, 'keyId', 'key_id'), 'preKey keyId'),
+            publicKey: decodeKey(field(rawPreKey, 'publicKey', 'public_key'), 'preKey publicKey')
+        };
+    }
+    return {
+        deviceId: decodeId(field(device, 'deviceId', 'device_id'), 'deviceId', true),
+        registrationId: decodeId(field(device, 'registrationId', 'registration_id'),
+                                 'registrationId'),
+        identityKey,
+        signedPreKey,
+        preKey
+    };
+}
+
+
+function canonicalizePreKeyBundle(rawJSON) {
+    let raw;
+    try {
+        raw = typeof rawJSON === 'string' ? JSON.parse(rawJSON) : rawJSON;
+    } catch (e) {
+        throw new errors.MessageFormatError('Invalid prekey bundle JSON');
+    }
+    if (!raw || typeof raw !== 'object') {
+        throw new errors.MessageFormatError('Invalid prekey bundle');
+    }
+    const identityKey = decodeKey(field(raw, 'identityKey', 'identity_key'), 'identityKey');
+    const devices = Array.isArray(raw.devices) ? raw.devices : [raw];
+    if (!devices.length) {
+        throw new errors.MessageFormatError('Prekey bundle has no devices');
+    }
+    return devices.map(device => canonicalDevice(identityKey, device));
+}
+
+module.exports = {
+    canonicalizePreKeyBundle
+};
@@ -0,0 +1,51 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const nodeCrypto = require('crypto');
+
+/*
+ * Reference hash a reply uses to point at the message it quotes (integers big
+ * endian):
+ *
+ *   SHA-256("LibSignalQuote" || uint32 authorLength || author ||
+ *           uint64 timestamp || uint32 bodyLength || body)
+ *
+ * author is the original sender's identity (usually the 33 byte public key),
+ * timestamp the original sent time in ms since the epoch, and body the original
+ * plaintext bytes exactly as sent.  The length prefixes keep the split between
+ * fields unambiguous.
+ */
+const QUOTE_HASH_LABEL = 'LibSignalQuote';
+
+
+function lengthPrefixed(data) {
+    const length = Buffer.alloc(4);
+    length.writeUInt32BE(data.byteLength);
+    return [length, data];
+}
+
+
+function computeQuoteHash(originalAuthorIdentity, originalTimestamp, originalBody) {
+    if (!(originalAuthorIdentity instanceof Buffer) || !originalAuthorIdentity.byteLength) {
+        throw new TypeError('Original author identity must be a non-empty Buffer');
+    }
+    if (!Number.isSafeInteger(originalTimestamp) || originalTimestamp < 0) {
+        throw new RangeError('Invalid timestamp: ' + originalTimestamp);
+    }
+    if (!(originalBody instanceof Buffer)) {
+        throw new TypeError('Original body must be a Buffer');
+    }
+    const timestamp = Buffer.alloc(8);
+    timestamp.writeBigUInt64BE(BigInt(originalTimestamp));
+    const hash = nodeCrypto.createHash('sha256').update(QUOTE_HASH_LABEL);
+    for (const part of [...lengthPrefixed(originalAuthorIdentity), timestamp,
+                        ...lengthPrefixed(originalBody)]) {
+        hash.update(part);
+    }
+    return hash.digest();
+}
+
+module.exports = {
+    computeQuoteHash
+};
@@ -0,0 +1,87 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * One authenticated acknowledgement for many messages (integers big endian):
+ *
+ *   body   = timestamp (8) | count (2) | count * (idLength (1) | id)
+ *   bundle = body | HMAC-SHA256(macKey, "LibSignalReadReceipts" || body)
+ *
+ * Ids are 1 to 255 bytes and kept in the given order; the timestamp is when the
+ * messages were read, in ms since the epoch.
+ */
+const READ_RECEIPTS_LABEL = 'LibSignalReadReceipts';
+const MAX_RECEIPT_IDS = 1000;
+const MAC_LENGTH = 32;
+
+
+function assertMacKey(macKey) {
+    if (!(macKey instanceof Buffer) || macKey.byteLength !== 32) {
+        throw new TypeError('macKey must be a 32 byte Buffer');
+    }
+}
+
+function computeMac(macKey, body) {
+    return crypto.hmacSha256(macKey, Buffer.from(READ_RECEIPTS_LABEL), body);
+}
+
+
+function buildReadReceiptBundle(macKey, messageIds, timestamp) {
+    assertMacKey(macKey);
+    if (!Array.isArray(messageIds) || !messageIds.length || messageIds.length > MAX_RECEIPT_IDS) {
+        throw new RangeError(`messageIds must hold 1 to ${MAX_RECEIPT_IDS} ids`);
+    }
+    if (!Number.isSafeInteger(timestamp) || timestamp < 0) {
+        throw new RangeError('Invalid timestamp: ' + timestamp);
+    }
+    const header = Buffer.alloc(10);
+    header.writeBigUInt64BE(BigInt(timestamp));
+    header.writeUInt16BE(messageIds.length, 8);
+    const parts = [header];
+    messageIds.forEach((id, i) => {
+        if (!(id instanceof Buffer) || id.byteLength < 1 || id.byteLength > 0xff) {
+            throw new TypeError(`Invalid message id at index ${i}`);
+        }
+        parts.push(Buffer.from([id.byteLength]), id);
+    });
+    const body = Buffer.concat(parts);
+    return Buffer.concat([body, computeMac(macKey, body)]);
+}
+
+
+function openReadReceiptBundle(macKey, bundle) {
+    assertMacKey(macKey);
+    if (!(bundle instanceof Buffer) || bundle.byteLength < 10 + MAC_LENGTH) {
+        throw new errors.MessageFormatError('Read receipt bundle too short');
+    }
+    const body = bundle.subarray(0, -MAC_LENGTH);
+    if (!nodeCrypto.timingSafeEqual(computeMac(macKey, body), bundle.subarray(-MAC_LENGTH))) {
+        throw new errors.MacError('Bad MAC');
+    }
+    const timestamp = Number(body.readBigUInt64BE(0));
+    const count = body.readUInt16BE(8);
+    const messageIds = [];
+    let offset = 10;
+    for (let i = 0; i < count; i++) {
+        const length = offset < body.length ? body[offset] : 0;
+        if (!length || offset + 1 + length > body.length) {
+            throw new errors.MessageFormatError('Truncated read receipt bundle');
+        }
+        messageIds.push(body.subarray(offset + 1, offset + 1 + length));
+        offset += 1 + length;
+    }
+    if (offset !== body.length) {
+        throw new errors.MessageFormatError('Trailing data in read receipt bundle');
+    }
+    return {messageIds, timestamp};
+}
+
+module.exports = {
+    buildReadReceiptBundle,
+    openReadReceiptBundle
+};
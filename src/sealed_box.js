@@ -0,0 +1,102 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const errors = require('./errors');
+const nodeCrypto = require('crypto');
+
+/*
+ * One-shot public key encryption:
+ *
+ *   secret      = ECDH(ephemeral, recipient)
+ *   key, nonce  = HKDF(secret, info = label || ephemeralPub || recipientPub)
+ *   ciphertext  = AES-256-GCM(key, nonce, plaintext) || tag
+ *
+ * Binding both public keys into the info stops a ciphertext from being replayed
+ * under a different ephemeral or recipient key.
+ */
+const SEAL_INFO = 'LibSignalSealedBox';
+
+
+function deriveSealKeys(sharedSecret, ephemeralPubKey, recipientPubKey) {
+    const info = Buffer.concat([Buffer.from(SEAL_INFO), ephemeralPubKey, recipientPubKey]);
+    const secrets = crypto.deriveSecrets(sharedSecret, Buffer.alloc(32), info, 2);
+    return {key: secrets[0], nonce: secrets[1].subarray(0, 12)};
+}
+
+
+function seal(recipientPubKey, plaintext) {
+    if (!(plaintext instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${plaintext?.constructor?.name}`);
+    }
+    const ephemeral = curve.generateKeyPair();
+    const sharedSecret = curve.calculateAgreement(recipientPubKey, ephemeral.privKey);
+    const {key, nonce} = deriveSealKeys(sharedSecret, ephemeral.pubKey, recipientPubKey);
+    const cipher = nodeCrypto.createCipheriv('aes-256-gcm', key, nonce);
+    const ciphertext = Buffer.concat([cipher.update(plaintext), cipher.final(), cipher.getAuthTag()]);
+    return {
+        ephemeralPubKey: ephemeral.pubKey,
+        ciphertext
+    };
+}
+
+function assertRecipient(recipientPubKey) {
+    if (!(recipientPubKey instanceof Buffer) || recipientPubKey.byteLength !== 33 ||
+        recipientPubKey[0] !== 5) {
+        throw new Error('Invalid public key');
+    }
+}
+
+
+function sealToPublicKey(recipientPubKey, plaintext) {
+    assertRecipient(recipientPubKey);
+    return seal(recipientPubKey, plaintext);
+}
+
+
+/*
+ * Seals each payload under its own ephemeral key.  The recipient key and every
+ * payload are checked before anything is sealed, so a bad entry fails the
+ * whole batch.  Recipient keys are already Montgomery, so there is no key
+ * conversion to share between payloads.  Each one still costs a key generation
+ * and an agreement, the same as a sealToPublicKey call (see
+ * bench/sealed_box.js).
+ */
+function sealManyToPublicKey(recipientPubKey, plaintexts) {
+    assertRecipient(recipientPubKey);
+    if (!Array.isArray(plaintexts)) {
+        throw new TypeError('plaintexts must be an array');
+    }
+    plaintexts.forEach((plaintext, i) => {
+        if (!(plaintext instanceof Buffer)) {
+            throw new TypeError(`Expected Buffer at index ${i} instead of: ` +
+                                `${plaintext?.constructor?.name}`);
+        }
+    });
+    return plaintexts.map(plaintext => seal(recipientPubKey, plaintext));
+}
+
+
+function openFromPublicKey(recipientPrivKey, ephemeralPubKey, ciphertext) {
+    if (!(ciphertext instanceof Buffer) || ciphertext.byteLength < 16) {
+        throw new errors.DecryptionError('Sealed ciphertext too short');
+    }
+    const recipientPubKey = curve.createKeyPair(recipientPrivKey).pubKey;
+    const sharedSecret = curve.calculateAgreement(ephemeralPubKey, recipientPrivKey);
+    const {key, nonce} = deriveSealKeys(sharedSecret, ephemeralPubKey, recipientPubKey);
+    const decipher = nodeCrypto.createDecipheriv('aes-256-gcm', key, nonce);
+    decipher.setAuthTag(ciphertext.subarray(-16));
+    try {
+        return Buffer.concat([decipher.update(ciphertext.subarray(0, -16)), decipher.final()]);
+    } catch (e) {
+        throw new errors.DecryptionError('Sealed ciphertext failed authentication');
+    }
+}
+
+module.exports = {
+    openFromPublicKey,
+    sealManyToPublicKey,
+    sealToPublicKey
+};
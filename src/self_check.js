@@ -0,0 +1,72 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const curve = require('./curve');
+
+/*
+ * Known answer tests for the native curve code, to catch a broken build or a
+ * tampered binary before anything is trusted to it.  The agreement vector is
+ * the X25519 one from RFC 7748 section 6.1; the signature was made with
+ * Alice's key from the same vector (signing is deterministic).
+ */
+const ALICE_PRIVATE = '77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a';
+const ALICE_PUBLIC = '058520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a';
+const BOB_PUBLIC = '05de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f';
+const SHARED_SECRET = '4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742';
+const MESSAGE = 'libsignal self check';
+const SIGNATURE = '19179b7bea31cb7db431ded975f32bdf86ebf873f7aa072ee33663df04a67a99' +
+                  'b50572faf62bd1d1828e1f132077bf985dcb0ffe9ce5d34fda74de30466e7789';
+
+
+function hex(value) {
+    return Buffer.from(value, 'hex');
+}
+
+
+// Returns the names of the failed checks; an empty array means all passed.
+function runSelfCheck() {
+    const failures = [];
+    const check = (name, fn) => {
+        try {
+            if (!fn()) {
+                failures.push(name);
+            }
+        } catch (e) {
+            failures.push(name);
+        }
+    };
+    const message = Buffer.from(MESSAGE);
+    check('keypair', () =>
+        curve.createKeyPair(hex(ALICE_PRIVATE)).pubKey.equals(hex(ALICE_PUBLIC)));
+    check('agreement', () =>
+        curve.calculateAgreement(hex(BOB_PUBLIC), hex(ALICE_PRIVATE)).equals(hex(SHARED_SECRET)));
+    check('sign', () => {
+        // Signing uses the scalar as is, so it needs the clamped key.
+        const {privKey} = curve.createKeyPair(hex(ALICE_PRIVATE));
+        return curve.calculateSignature(privKey, message).equals(hex(SIGNATURE));
+    });
+    check('verify', () => {
+        const tampered = hex(SIGNATURE);
+        tampered[0] ^= 1;
+        // Both directions, so a verifier that always says yes also fails.
+        return curve.verifySignature(hex(ALICE_PUBLIC), message, hex(SIGNATURE)) &&
+            !curve.verifySignature(hex(ALICE_PUBLIC), message, tampered);
+    });
+    return failures;
+}
+
+
+// Runs the checks, logging any failures, and reports whether they all passed.
+function isHealthy() {
+    const failures = runSelfCheck();
+    if (failures.length) {
+        console.error(`libsignal self check failed: ${failures.join(', ')}`);
+    }
+    return !failures.length;
+}
+
+module.exports = {
+    isHealthy,
+    runSelfCheck
+};
@@ -0,0 +1,61 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+
+/*
+ * Sender key chain for group messages, following libsignal's SenderKeyState:
+ *
+ *   messageSeed  = HMAC(chainKey, 0x01)
+ *   nextChainKey = HMAC(chainKey, 0x02)
+ *   HKDF(messageSeed, salt = 0 * 32, info = "WhisperGroup", 48) -> iv (16) | cipherKey (32)
+ *
+ * The chain starts from the 32 byte seed in the sender key distribution
+ * message at iteration 0, and every member at the same iteration derives the
+ * same message key.
+ */
+const SENDER_KEY_INFO = 'WhisperGroup';
+const MAX_SENDER_KEY_ITERATION = 25000;
+
+
+function assertChainKey(chainKey) {
+    if (!(chainKey instanceof Buffer) || chainKey.byteLength !== 32) {
+        throw new TypeError('Chain key must be a 32 byte Buffer');
+    }
+}
+
+
+function deriveSenderMessageKey(chainKey) {
+    assertChainKey(chainKey);
+    const seed = crypto.calculateMAC(chainKey, Buffer.from([1]));
+    const derived = crypto.hkdf(seed, Buffer.alloc(0), Buffer.from(SENDER_KEY_INFO), 48);
+    return {
+        messageKey: {
+            seed,
+            iv: derived.subarray(0, 16),
+            cipherKey: derived.subarray(16)
+        },
+        nextChainKey: crypto.calculateMAC(chainKey, Buffer.from([2]))
+    };
+}
+
+
+// The chain key at the given iteration, starting from the distributed seed.
+function senderChainKeyFromSeed(seed, iteration) {
+    assertChainKey(seed);
+    if (!Number.isInteger(iteration) || iteration < 0 || iteration > MAX_SENDER_KEY_ITERATION) {
+        throw new RangeError('Invalid iteration: ' + iteration);
+    }
+    let chainKey = seed;
+    for (let i = 0; i < iteration; i++) {
+        chainKey = crypto.calculateMAC(chainKey, Buffer.from([2]));
+    }
+    return chainKey;
+}
+
+module.exports = {
+    MAX_SENDER_KEY_ITERATION,
+    deriveSenderMessageKey,
+    senderChainKeyFromSeed
+};
@@ -1,6 +1,7 @@
 // vim: ts=4:sw=4
 
 const BaseKeyType = require('./base_key_type');
+const util = require('util');
 
 const CLOSED_SESSIONS_MAX = 40;
 const SESSION_RECORD_VERSION = 'v1';
@@ -180,12 +181,67 @@ const migrations = [{
 }];
 
 
+// Results of SessionRecord.compareRatchetStates.
+const RATCHET_STATES_IDENTICAL = 0;
+const RATCHET_STATES_AHEAD = 1;
+const RATCHET_STATES_DIVERGENT = 2;
+
+function isAheadOf(a, b) {
+    if (!a.indexInfo.baseKey.equals(b.indexInfo.baseKey) ||
+        !a.indexInfo.remoteIdentityKey.equals(b.indexInfo.remoteIdentityKey)) {
+        return false;
+    }
+    const aSending = a.currentRatchet.ephemeralKeyPair.pubKey;
+    const sameRatchet = aSending.equals(b.currentRatchet.ephemeralKeyPair.pubKey);
+    if (sameRatchet && !a.currentRatchet.rootKey.equals(b.currentRatchet.rootKey)) {
+        return false;
+    }
+    for (const [key, chain] of a.chains()) {
+        const other = b.getChain(key);
+        if (!other) {
+            // Stepping the ratchet drops our old sending chain, nothing else.
+            if (sameRatchet || !key.equals(aSending)) {
+                return false;
+            }
+            continue;
+        }
+        if (other.chainKey.counter < chain.chainKey.counter ||
+            (!chain.chainKey.key && other.chainKey.key)) {
+            return false;
+        }
+        if (other.chainKey.counter === chain.chainKey.counter && chain.chainKey.key &&
+            !chain.chainKey.key.equals(other.chainKey.key)) {
+            return false;
+        }
+    }
+    return true;
+}
+
+
 class SessionRecord {
 
     static createEntry() {
         return new SessionEntry();
     }
 
+    /*
+     * Compares two serialized session entries (SessionEntry.serialize() output
+     * or its JSON) for multi-device reconciliation: 0 when identical, 1 when b
+     * is the same session moved strictly forward (every chain of a is in b at
+     * the same or a later counter, allowing for a ratchet step), 2 otherwise,
+     * which includes b being behind a.
+     */
+    static compareRatchetStates(a, b) {
+        const dataA = typeof a === 'string' ? JSON.parse(a) : a;
+        const dataB = typeof b === 'string' ? JSON.parse(b) : b;
+        const entryA = SessionEntry.deserialize(dataA);
+        const entryB = SessionEntry.deserialize(dataB);
+        if (util.isDeepStrictEqual(entryA.serialize(), entryB.serialize())) {
+            return RATCHET_STATES_IDENTICAL;
+        }
+        return isAheadOf(entryA, entryB) ? RATCHET_STATES_AHEAD : RATCHET_STATES_DIVERGENT;
+    }
+
     static migrate(data) {
         let run = (data.version === undefined);
         for (let i = 0; i < migrations.length; ++i) {
@@ -0,0 +1,56 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const errors = require('./errors');
+
+/*
+ * A signed message is signature (64) || ciphertext where the signature is made
+ * by the sender's identity key over the ciphertext and the ciphertext is
+ * AES-256-CBC under keys derived from the message key the same way
+ * SessionCipher derives them.
+ */
+const whisperMsgKeys = 'WhisperMessageKeys';
+
+
+function deriveKeys(messageKey) {
+    if (!(messageKey instanceof Buffer) || messageKey.byteLength !== 32) {
+        throw new TypeError('messageKey must be a 32 byte Buffer');
+    }
+    const keys = crypto.deriveSecrets(messageKey, Buffer.alloc(32), Buffer.from(whisperMsgKeys));
+    return {cipherKey: keys[0], iv: keys[2].subarray(0, 16)};
+}
+
+
+function createSignedMessage(senderIdentityPrivKey, messageKey, plaintext) {
+    const {cipherKey, iv} = deriveKeys(messageKey);
+    const ciphertext = crypto.encrypt(cipherKey, plaintext, iv);
+    const signature = curve.calculateSignature(senderIdentityPrivKey, ciphertext);
+    return Buffer.concat([signature, ciphertext]);
+}
+
+
+function openSignedMessage(senderIdentityPubKey, messageKey, message) {
+    if (!(message instanceof Buffer) || message.byteLength <= 64) {
+        throw new errors.SignatureError('Signed message too short');
+    }
+    const signature = message.subarray(0, 64);
+    const ciphertext = message.subarray(64);
+    // Nothing about the ciphertext is looked at until the signature checks out.
+    if (!curve.verifySignature(senderIdentityPubKey, ciphertext, signature)) {
+        throw new errors.SignatureError('Invalid message signature');
+    }
+    const {cipherKey, iv} = deriveKeys(messageKey);
+    try {
+        return crypto.decrypt(cipherKey, ciphertext, iv);
+    } catch (e) {
+        throw new errors.DecryptionError('Failed to decrypt signed message');
+    }
+}
+
+module.exports = {
+    createSignedMessage,
+    openSignedMessage
+};
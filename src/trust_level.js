@@ -0,0 +1,7 @@
+const TrustLevel = {
+    UNTRUSTED: 0,
+    TRUSTED: 1,
+    VERIFIED: 2
+};
+
+module.exports = TrustLevel;
@@ -0,0 +1,129 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const crypto = require('./crypto');
+const curve = require('./curve');
+const errors = require('./errors');
+
+/*
+ * Initiation layout (integers big endian):
+ *
+ *   version (1) | flags (1) | identityKey (33) | ephemeralKey (33) |
+ *   signedPreKeyId (4) | [oneTimePreKeyId (4)] | ciphertext
+ *
+ * Bit 0 of flags marks the presence of oneTimePreKeyId.
+ */
+const X3DH_INITIATION_VERSION = 1;
+const FLAG_ONE_TIME_PREKEY = 0x01;
+const HEADER_LENGTH = 1 + 1 + 33 + 33 + 4;
+
+
+function isPubKey(key) {
+    return key instanceof Buffer && key.byteLength === 33 && key[0] === 5;
+}
+
+function isUint32(n) {
+    return Number.isInteger(n) && n >= 0 && n <= 0xffffffff;
+}
+
+
+function buildX3dhInitiation(identityKey, ephemeralKey, signedPreKeyId, oneTimePreKeyId,
+                             ciphertext) {
+    if (!isPubKey(identityKey)) {
+        throw new TypeError('Invalid identity key');
+    }
+    if (!isPubKey(ephemeralKey)) {
+        throw new TypeError('Invalid ephemeral key');
+    }
+    if (!isUint32(signedPreKeyId)) {
+        throw new TypeError('Invalid signedPreKeyId: ' + signedPreKeyId);
+    }
+    if (oneTimePreKeyId != null && !isUint32(oneTimePreKeyId)) {
+        throw new TypeError('Invalid oneTimePreKeyId: ' + oneTimePreKeyId);
+    }
+    if (!(ciphertext instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${ciphertext?.constructor?.name}`);
+    }
+    const hasOneTimePreKey = oneTimePreKeyId != null;
+    const header = Buffer.alloc(HEADER_LENGTH + (hasOneTimePreKey ? 4 : 0));
+    header[0] = X3DH_INITIATION_VERSION;
+    header[1] = hasOneTimePreKey ? FLAG_ONE_TIME_PREKEY : 0;
+    header.set(identityKey, 2);
+    header.set(ephemeralKey, 35);
+    header.writeUInt32BE(signedPreKeyId, 68);
+    if (hasOneTimePreKey) {
+        header.writeUInt32BE(oneTimePreKeyId, HEADER_LENGTH);
+    }
+    return Buffer.concat([header, ciphertext]);
+}
+
+
+function parseX3dhInitiation(data) {
+    if (!(data instanceof Buffer)) {
+        throw new TypeError(`Expected Buffer instead of: ${data?.constructor?.name}`);
+    }
+    if (data.byteLength < HEADER_LENGTH) {
+        throw new errors.MessageFormatError('X3DH initiation too short');
+    }
+    if (data[0] !== X3DH_INITIATION_VERSION) {
+        throw new errors.MessageFormatError('Unknown X3DH initiation version: ' + data[0]);
+    }
+    const flags = data[1];
+    if (flags & ~FLAG_ONE_TIME_PREKEY) {
+        throw new errors.MessageFormatError('Unknown X3DH initiation flags: ' + flags);
+    }
+    const identityKey = Buffer.from(data.subarray(2, 35));
+    const ephemeralKey = Buffer.from(data.subarray(35, 68));
+    if (!isPubKey(identityKey) || !isPubKey(ephemeralKey)) {
+        throw new errors.MessageFormatError('Invalid key in X3DH initiation');
+    }
+    const signedPreKeyId = data.readUInt32BE(68);
+    let offset = HEADER_LENGTH;
+    let oneTimePreKeyId;
+    if (flags & FLAG_ONE_TIME_PREKEY) {
+        if (data.byteLength < offset + 4) {
+            throw new errors.MessageFormatError('X3DH initiation too short');
+        }
+        oneTimePreKeyId = data.readUInt32BE(offset);
+        offset += 4;
+    }
+    return {
+        version: X3DH_INITIATION_VERSION,
+        identityKey,
+        ephemeralKey,
+        signedPreKeyId,
+        oneTimePreKeyId,
+        ciphertext: Buffer.from(data.subarray(offset))
+    };
+}
+
+/*
+ * Initiator side X3DH master secret:
+ *
+ *   HKDF(0xff * 32 || DH(IKa, SPKb) || DH(EKa, IKb) || DH(EKa, SPKb) || [DH(EKa, OPKb)],
+ *        salt = 0 * 32, info = "WhisperText")[0:32]
+ *
+ * This is the root key SessionBuilder.initSession starts from on both sides.
+ */
+function x3dhAgreement(identityPrivKey, ephemeralPrivKey, signedPreKeyPubKey, identityPubKey,
+                       oneTimePreKeyPubKey) {
+    const parts = [
+        Buffer.alloc(32, 0xff),
+        curve.calculateAgreement(signedPreKeyPubKey, identityPrivKey),
+        curve.calculateAgreement(identityPubKey, ephemeralPrivKey),
+        curve.calculateAgreement(signedPreKeyPubKey, ephemeralPrivKey)
+    ];
+    if (oneTimePreKeyPubKey) {
+        parts.push(curve.calculateAgreement(oneTimePreKeyPubKey, ephemeralPrivKey));
+    }
+    return crypto.deriveSecrets(Buffer.concat(parts), Buffer.alloc(32),
+                                Buffer.from('WhisperText'), 1)[0];
+}
+
+module.exports = {
+    X3DH_INITIATION_VERSION,
+    buildX3dhInitiation,
+    parseX3dhInitiation,
+    x3dhAgreement
+};
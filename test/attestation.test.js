@@ -0,0 +1,95 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const attestation = require('../src/attestation');
+const curve = require('../src/curve');
+const {describe, it} = require('node:test');
+
+
+describe('aggregate prekey signatures', () => {
+    const identityKeyPair = curve.generateKeyPair();
+    const preKeys = [0, 1, 2].map(() => curve.generateKeyPair().pubKey);
+
+    it('round trips', () => {
+        const signature = attestation.signAggregatePreKeys(identityKeyPair.privKey, preKeys);
+        assert.strictEqual(attestation.verifyAggregatePreKeySignature(identityKeyPair.pubKey,
+                                                                      preKeys, signature), true);
+    });
+
+    it('rejects a tampered middle prekey', () => {
+        const signature = attestation.signAggregatePreKeys(identityKeyPair.privKey, preKeys);
+        const tampered = preKeys.map(x => Buffer.from(x));
+        tampered[1][7] ^= 1;
+        assert.strictEqual(attestation.verifyAggregatePreKeySignature(identityKeyPair.pubKey,
+                                                                      tampered, signature), false);
+    });
+
+    it('rejects reordered and dropped prekeys', () => {
+        const signature = attestation.signAggregatePreKeys(identityKeyPair.privKey, preKeys);
+        for (const batch of [[preKeys[1], preKeys[0], preKeys[2]], preKeys.slice(0, 2)]) {
+            assert.strictEqual(attestation.verifyAggregatePreKeySignature(identityKeyPair.pubKey,
+                                                                          batch, signature), false);
+        }
+    });
+
+    it('keeps key boundaries in the signed encoding', () => {
+        const joined = [Buffer.concat([preKeys[0], preKeys[1]]), preKeys[2]];
+        const signature = attestation.signAggregatePreKeys(identityKeyPair.privKey, preKeys);
+        assert.strictEqual(attestation.verifyAggregatePreKeySignature(identityKeyPair.pubKey,
+                                                                      joined, signature), false);
+    });
+
+    it('rejects a signature from another identity', () => {
+        const other = curve.generateKeyPair();
+        const signature = attestation.signAggregatePreKeys(other.privKey, preKeys);
+        assert.strictEqual(attestation.verifyAggregatePreKeySignature(identityKeyPair.pubKey,
+                                                                      preKeys, signature), false);
+    });
+});
+
+describe('prekey batch Merkle proofs', () => {
+    const preKeys = [0, 1, 2, 3, 4].map(() => curve.generateKeyPair().pubKey);
+    const root = attestation.prekeyBatchMerkleRoot(preKeys);
+
+    it('proves every member', () => {
+        for (const preKey of preKeys) {
+            const proof = attestation.prekeyMembershipProof(preKeys, preKey);
+            assert.strictEqual(proof.leafCount, preKeys.length);
+            assert.strictEqual(attestation.verifyPrekeyMembership(root, preKey, proof), true);
+        }
+    });
+
+    it('rejects a non-member', () => {
+        const proof = attestation.prekeyMembershipProof(preKeys, preKeys[0]);
+        assert.strictEqual(attestation.verifyPrekeyMembership(root, curve.generateKeyPair().pubKey,
+                                                              proof), false);
+    });
+
+    it('rejects an index at or past the leaf count', () => {
+        // The lone last leaf of an odd batch is paired with itself, so index
+        // leafCount would otherwise walk an identical path.
+        const lastKey = preKeys.slice().sort(Buffer.compare)[4];
+        const proof = attestation.prekeyMembershipProof(preKeys, lastKey);
+        assert.strictEqual(proof.index, 4);
+        for (const index of [5, 6, 7, 8]) {
+            assert.strictEqual(attestation.verifyPrekeyMembership(root, lastKey,
+                {...proof, index}), false);
+        }
+    });
+
+    it('rejects a proof with the wrong depth', () => {
+        const proof = attestation.prekeyMembershipProof(preKeys, preKeys[0]);
+        for (const siblings of [proof.siblings.slice(0, -1), [...proof.siblings, root]]) {
+            assert.strictEqual(attestation.verifyPrekeyMembership(root, preKeys[0],
+                {...proof, siblings}), false);
+        }
+    });
+
+    it('rejects a proof without a leaf count', () => {
+        const {index, siblings} = attestation.prekeyMembershipProof(preKeys, preKeys[0]);
+        assert.strictEqual(attestation.verifyPrekeyMembership(root, preKeys[0], {index, siblings}),
+                           false);
+    });
+});
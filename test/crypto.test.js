@@ -0,0 +1,272 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const crypto = require('../src/crypto');
+const errors = require('../src/errors');
+const nodeCrypto = require('crypto');
+const {describe, it} = require('node:test');
+
+const hex = x => Buffer.from(x, 'hex');
+
+
+describe('decrypt', () => {
+    const key = nodeCrypto.randomBytes(32);
+    const iv = nodeCrypto.randomBytes(16);
+
+    // Ciphertext whose last block decrypts to the given bytes, with no padding
+    // applied, as a tampered but MAC-valid message would.
+    function rawEncrypt(plaintext) {
+        const cipher = nodeCrypto.createCipheriv('aes-256-cbc', key, iv);
+        cipher.setAutoPadding(false);
+        return Buffer.concat([cipher.update(plaintext), cipher.final()]);
+    }
+
+    it('round trips', () => {
+        for (const length of [0, 1, 15, 16, 17, 100]) {
+            const plaintext = nodeCrypto.randomBytes(length);
+            assert.deepStrictEqual(crypto.decrypt(key, crypto.encrypt(key, plaintext, iv), iv),
+                                   plaintext);
+        }
+    });
+
+    // Pad byte 0, pad byte above the block size, inconsistent pad bytes, and a
+    // valid first block followed by a bad one.
+    it('rejects corrupted padding with DecryptionError', () => {
+        const badPadding = [
+            Buffer.alloc(16, 0),
+            Buffer.alloc(16, 0x11),
+            Buffer.concat([Buffer.alloc(14), hex('0302')]),
+            Buffer.concat([Buffer.alloc(16, 0x10), Buffer.alloc(16, 0x20)])
+        ];
+        for (const plaintext of badPadding) {
+            assert.throws(() => crypto.decrypt(key, rawEncrypt(plaintext), iv),
+                          e => e instanceof errors.DecryptionError &&
+                               e.message === 'Implausible plaintext length');
+        }
+    });
+
+    it('rejects partial blocks with DecryptionError', () => {
+        const ciphertext = crypto.encrypt(key, Buffer.from('hello'), iv);
+        for (const data of [ciphertext.subarray(0, 15), Buffer.alloc(0)]) {
+            assert.throws(() => crypto.decrypt(key, data, iv), errors.DecryptionError);
+        }
+    });
+});
+
+describe('blake2bKdf', () => {
+    // There are no published HKDF-BLAKE2b vectors.  These run the RFC 5869 test
+    // case 1, 2 and 3 inputs through HKDF with HMAC-BLAKE2b-512.  The expected
+    // output comes from Python's hmac and hashlib.blake2b, an independent
+    // implementation.
+    const vectors = [
+        {
+            ikm: '0b'.repeat(22),
+            salt: '000102030405060708090a0b0c',
+            info: 'f0f1f2f3f4f5f6f7f8f9',
+            okm: '8815e1a85b5e90e6174323fdd180248887a7138af6dc5c8320fde21a60a07880' +
+                 '8267d6a41b6a938d7b30'
+        },
+        {
+            ikm: Buffer.from(Array.from({length: 0x50}, (_, i) => i)).toString('hex'),
+            salt: Buffer.from(Array.from({length: 0x50}, (_, i) => 0x60 + i)).toString('hex'),
+            info: Buffer.from(Array.from({length: 0x50}, (_, i) => 0xb0 + i)).toString('hex'),
+            okm: 'bb19eccde3ff3f41a8b3a147eb4fa640599a4e2194aadd98c0458f7ec05ac995' +
+                 '238f9b6002d5bcbfa7c67975965de73ff014e55acff823162d6d5c04498501b1' +
+                 'acb5e99058466d1a440ffc544f408e89f555'
+        },
+        {
+            ikm: '0b'.repeat(22),
+            salt: '',
+            info: '',
+            okm: '817520332f597bd8f557a4b40fddfe7674f1edac6c8a1a36fa0546b649bfae4a' +
+                 '2ed3f34d03fdef572d51'
+        }
+    ];
+
+    vectors.forEach((v, i) => {
+        it(`matches known answer ${i + 1}`, () => {
+            assert.strictEqual(crypto.blake2bKdf(hex(v.ikm), hex(v.salt), hex(v.info),
+                                                 v.okm.length / 2).toString('hex'), v.okm);
+        });
+    });
+
+    it('is not the SHA-256 HKDF', () => {
+        const v = vectors[0];
+        assert.notDeepStrictEqual(crypto.blake2bKdf(hex(v.ikm), hex(v.salt), hex(v.info), 42),
+                                  crypto.hkdf(hex(v.ikm), hex(v.salt), hex(v.info), 42));
+    });
+
+    it('rejects lengths beyond 255 blocks', () => {
+        assert.throws(() => crypto.blake2bKdf(Buffer.alloc(1), Buffer.alloc(0), Buffer.alloc(0),
+                                              255 * 64 + 1), RangeError);
+    });
+});
+
+describe('hmacSha256', () => {
+    // RFC 4231 section 4, HMAC-SHA-256.  Case 5 covers truncated output, which
+    // hmacSha256 doesn't offer.
+    const largeKey = 'aa'.repeat(131);
+    const vectors = [
+        {
+            name: 'case 1',
+            key: '0b'.repeat(20),
+            data: Buffer.from('Hi There').toString('hex'),
+            mac: 'b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7'
+        },
+        {
+            name: 'case 2',
+            key: Buffer.from('Jefe').toString('hex'),
+            data: Buffer.from('what do ya want for nothing?').toString('hex'),
+            mac: '5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843'
+        },
+        {
+            name: 'case 3',
+            key: 'aa'.repeat(20),
+            data: 'dd'.repeat(50),
+            mac: '773ea91e36800e46854db8ebd09181a72959098b3ef8c122d9635514ced565fe'
+        },
+        {
+            name: 'case 4',
+            key: '0102030405060708090a0b0c0d0e0f10111213141516171819',
+            data: 'cd'.repeat(50),
+            mac: '82558a389a443c0ea4cc819899f2083a85f0faa3e578f8077a2e3ff46729665b'
+        },
+        {
+            name: 'case 6',
+            key: largeKey,
+            data: Buffer.from('Test Using Larger Than Block-Size Key - Hash Key First')
+                .toString('hex'),
+            mac: '60e431591ee0b67f0d8a26aacbf5b77f8e0bc6213728c5140546040f0ee37f54'
+        },
+        {
+            name: 'case 7',
+            key: largeKey,
+            data: Buffer.from('This is a test using a larger than block-size key and a larger ' +
+                              'than block-size data. The key needs to be hashed before being ' +
+                              'used by the HMAC algorithm.').toString('hex'),
+            mac: '9b09ffa71b942fcb27635fbcd5b0e944bfdc63644f0713938a7f51535c3a35e2'
+        }
+    ];
+
+    for (const v of vectors) {
+        it(`matches RFC 4231 ${v.name}`, () => {
+            assert.strictEqual(crypto.hmacSha256(hex(v.key), hex(v.data)).toString('hex'), v.mac);
+        });
+
+        it(`matches RFC 4231 ${v.name} over split chunks`, () => {
+            const data = hex(v.data);
+            const chunks = [data.subarray(0, 3), Buffer.alloc(0), data.subarray(3)];
+            assert.strictEqual(crypto.hmacSha256(hex(v.key), ...chunks).toString('hex'), v.mac);
+        });
+    }
+});
+
+describe('AES-256-GCM', () => {
+    // Test cases 13 to 16 of the GCM specification (McGrew and Viega), the
+    // AES-256 vectors with 96 bit IVs that NIST's GCM validation uses.
+    const K = 'feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308';
+    const IV = 'cafebabefacedbaddecaf888';
+    const P = 'd9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a72' +
+              '1c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255';
+    const C = '522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa' +
+              '8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662898015ad';
+    const vectors = [
+        {
+            name: 'test case 13',
+            key: '00'.repeat(32), nonce: '00'.repeat(12), plaintext: '',
+            ciphertext: '', tag: '530f8afbc74536b9a963b4f1c4cb738b'
+        },
+        {
+            name: 'test case 14',
+            key: '00'.repeat(32), nonce: '00'.repeat(12), plaintext: '00'.repeat(16),
+            ciphertext: 'cea7403d4d606b6e074ec5d3baf39d18', tag: 'd0d1c8a799996bf0265b98b5d48ab919'
+        },
+        {
+            name: 'test case 15',
+            key: K, nonce: IV, plaintext: P,
+            ciphertext: C, tag: 'b094dac5d93471bdec1a502270e3cc6c'
+        },
+        {
+            name: 'test case 16',
+            key: K, nonce: IV, plaintext: P.slice(0, 120),
+            aad: 'feedfacedeadbeeffeedfacedeadbeefabaddad2',
+            ciphertext: C.slice(0, 120), tag: '76fc6ece0f4e1768cddf8853bb2d551b'
+        }
+    ];
+    const aadOf = v => v.aad === undefined ? undefined : hex(v.aad);
+
+    for (const v of vectors) {
+        it(`encrypts ${v.name}`, () => {
+            const out = crypto.aesGcmEncrypt(hex(v.key), hex(v.nonce), hex(v.plaintext), aadOf(v));
+            assert.strictEqual(out.toString('hex'), v.ciphertext + v.tag);
+        });
+
+        it(`decrypts ${v.name}`, () => {
+            const out = crypto.aesGcmDecrypt(hex(v.key), hex(v.nonce), hex(v.ciphertext + v.tag),
+                                             aadOf(v));
+            assert.strictEqual(out.toString('hex'), v.plaintext);
+        });
+
+        it(`rejects a tampered tag on ${v.name}`, () => {
+            const sealed = hex(v.ciphertext + v.tag);
+            sealed[sealed.length - 1] ^= 1;
+            assert.throws(() => crypto.aesGcmDecrypt(hex(v.key), hex(v.nonce), sealed, aadOf(v)),
+                          errors.AuthenticationError);
+        });
+    }
+
+    it('rejects tampered ciphertext and aad', () => {
+        const v = vectors[3];
+        const sealed = hex(v.ciphertext + v.tag);
+        sealed[0] ^= 1;
+        assert.throws(() => crypto.aesGcmDecrypt(hex(v.key), hex(v.nonce), sealed, aadOf(v)),
+                      errors.AuthenticationError);
+        const aad = hex(v.aad);
+        aad[0] ^= 1;
+        assert.throws(() => crypto.aesGcmDecrypt(hex(v.key), hex(v.nonce),
+                                                 hex(v.ciphertext + v.tag), aad),
+                      errors.AuthenticationError);
+        assert.throws(() => crypto.aesGcmDecrypt(hex(v.key), hex(v.nonce),
+                                                 hex(v.ciphertext + v.tag)),
+                      errors.AuthenticationError);
+    });
+
+    it('rejects input shorter than a tag', () => {
+        assert.throws(() => crypto.aesGcmDecrypt(hex(K), hex(IV), Buffer.alloc(15)),
+                      errors.AuthenticationError);
+    });
+});
+
+describe('constantTimeEqual', () => {
+    const a = nodeCrypto.randomBytes(32);
+
+    it('matches equal contents', () => {
+        assert.strictEqual(crypto.constantTimeEqual(a, Buffer.from(a)), true);
+        assert.strictEqual(crypto.constantTimeEqual(Buffer.alloc(0), Buffer.alloc(0)), true);
+    });
+
+    it('rejects equal length mismatches wherever they are', () => {
+        for (const index of [0, 15, 31]) {
+            const b = Buffer.from(a);
+            b[index] ^= 0x80;
+            assert.strictEqual(crypto.constantTimeEqual(a, b), false);
+        }
+    });
+
+    it('returns false for unequal lengths', () => {
+        assert.strictEqual(crypto.constantTimeEqual(a, a.subarray(0, 31)), false);
+        assert.strictEqual(crypto.constantTimeEqual(a, Buffer.concat([a, Buffer.alloc(1)])), false);
+        assert.strictEqual(crypto.constantTimeEqual(Buffer.alloc(0), a), false);
+    });
+
+    it('throws TypeError for non-Buffer input', () => {
+        for (const value of [undefined, null, 'abc', [1, 2], new Uint8Array(32), 5]) {
+            assert.throws(() => crypto.constantTimeEqual(a, value),
+                          e => e instanceof TypeError && /^Expected Buffer/.test(e.message));
+            assert.throws(() => crypto.constantTimeEqual(value, a),
+                          e => e instanceof TypeError && /^Expected Buffer/.test(e.message));
+        }
+    });
+});
@@ -0,0 +1,474 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const curve = require('../src/curve');
+const curveMath = require('../src/curve25519_math');
+const errors = require('../src/errors');
+const native = require('../build/Release/signal_crypto');
+const nodeCrypto = require('crypto');
+const {describe, it} = require('node:test');
+
+const hex = x => Buffer.from(x, 'hex');
+
+
+describe('verifySignature', () => {
+    const keyPair = curve.generateKeyPair();
+    const message = Buffer.from('signed prekey');
+    const signature = curve.calculateSignature(keyPair.privKey, message);
+    const tampered = Buffer.from(signature);
+    tampered[10] ^= 1;
+    const otherMessage = Buffer.from('signed prekez');
+
+    const cases = [
+        {name: 'valid', pubKey: keyPair.pubKey, msg: message, sig: signature, expect: true},
+        {name: 'tampered signature', pubKey: keyPair.pubKey, msg: message, sig: tampered,
+         expect: false},
+        {name: 'other message', pubKey: keyPair.pubKey, msg: otherMessage, sig: signature,
+         expect: false},
+        {name: 'other key', pubKey: curve.generateKeyPair().pubKey, msg: message, sig: signature,
+         expect: false},
+        {name: 'truncated signature', pubKey: keyPair.pubKey, msg: message,
+         sig: signature.subarray(0, 63), throws: errors.ErrorCode.INVALID_SIGNATURE},
+        {name: 'empty signature', pubKey: keyPair.pubKey, msg: message, sig: Buffer.alloc(0),
+         throws: errors.ErrorCode.INVALID_SIGNATURE}
+    ];
+
+    for (const isInit of [false, true]) {
+        for (const c of cases) {
+            it(`${c.name} with isInit ${isInit}`, () => {
+                const verify = () => curve.verifySignature(c.pubKey, c.msg, c.sig, isInit);
+                if (c.throws) {
+                    assert.throws(verify, e => e instanceof errors.CurveError && e.code === c.throws);
+                } else {
+                    assert.strictEqual(verify(), c.expect);
+                }
+            });
+        }
+    }
+
+    it('accepts a bare 32 byte key with isInit and still checks the signature', () => {
+        const bare = keyPair.pubKey.subarray(1);
+        assert.strictEqual(curve.verifySignature(bare, message, signature, true), true);
+        assert.strictEqual(curve.verifySignature(bare, message, tampered, true), false);
+    });
+});
+
+describe('xeddsaVerify', () => {
+    // From libsignal-protocol-java's Curve25519Test.testSignature.  The
+    // signature carries the Edwards sign bit in sig[63] & 0x80.
+    const LIBSIGNAL_PRIVATE = hex('c097248412e58bf05df487968205132794178e367637f5818f81e0e6ce73e865');
+    const LIBSIGNAL_PUBLIC = hex('05ab7e717d4a163b7d9a1d8071dfe9dcf8cdcd1cea3339b6356be84d887e322c64');
+    const LIBSIGNAL_MESSAGE = hex('05edce9d9c415ca78cb7252e72c2c4a554d3eb29485a0e1d503118d1a82d99fb4a');
+    const LIBSIGNAL_SIGNATURE = hex('5de88ca9a89b4a115da79109c67c9c7464a3e4180274f1cb8c63c2984e286dfb' +
+                                    'ede82deb9dcd9fae0bfbb821569b3d9001bd8130cd11d486cef047bd60b86e88');
+
+    it('verifies the libsignal vector', () => {
+        assert.deepStrictEqual(curve.createKeyPair(LIBSIGNAL_PRIVATE).pubKey, LIBSIGNAL_PUBLIC);
+        assert.ok(LIBSIGNAL_SIGNATURE[63] & 0x80);
+        assert.strictEqual(curve.xeddsaVerify(LIBSIGNAL_PUBLIC, LIBSIGNAL_MESSAGE,
+                                              LIBSIGNAL_SIGNATURE), true);
+        assert.strictEqual(curve.verifySignature(LIBSIGNAL_PUBLIC, LIBSIGNAL_MESSAGE,
+                                                 LIBSIGNAL_SIGNATURE), true);
+    });
+
+    it('rejects the libsignal vector with the sign bit flipped', () => {
+        const sig = Buffer.from(LIBSIGNAL_SIGNATURE);
+        sig[63] ^= 0x80;
+        assert.strictEqual(curve.xeddsaVerify(LIBSIGNAL_PUBLIC, LIBSIGNAL_MESSAGE, sig), false);
+    });
+
+    it('verifies calculateSignature output whatever the sign bit', () => {
+        const signs = new Set();
+        for (let i = 0; i < 200; i++) {
+            const keyPair = curve.generateKeyPair();
+            const message = nodeCrypto.randomBytes(32);
+            const sig = curve.calculateSignature(keyPair.privKey, message);
+            signs.add(sig[63] & 0x80);
+            assert.strictEqual(curve.xeddsaVerify(keyPair.pubKey, message, sig), true);
+        }
+        assert.strictEqual(signs.size, 2);
+    });
+
+    it('verifies xeddsaSign output', () => {
+        for (let i = 0; i < 50; i++) {
+            const keyPair = curve.generateKeyPair();
+            const message = nodeCrypto.randomBytes(32);
+            const sig = curve.xeddsaSign(keyPair.privKey, message);
+            assert.strictEqual(curve.xeddsaVerify(keyPair.pubKey, message, sig), true);
+        }
+    });
+
+    it('rejects s of 2^253 or more', () => {
+        for (const bits of [0x20, 0x40, 0x60]) {
+            const sig = Buffer.from(LIBSIGNAL_SIGNATURE);
+            sig[63] |= bits;
+            assert.strictEqual(curve.xeddsaVerify(LIBSIGNAL_PUBLIC, LIBSIGNAL_MESSAGE, sig), false);
+        }
+    });
+
+    it('rejects a non-canonical u coordinate', () => {
+        // p + 1, a non-canonical encoding of u = 1.
+        const keyPair = curve.generateKeyPair();
+        const nonCanonical = hex('05eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f');
+        const sig = curve.calculateSignature(keyPair.privKey, LIBSIGNAL_MESSAGE);
+        assert.strictEqual(curve.xeddsaVerify(nonCanonical, LIBSIGNAL_MESSAGE, sig), false);
+    });
+
+    it('rejects a tampered message', () => {
+        const message = Buffer.from(LIBSIGNAL_MESSAGE);
+        message[5] ^= 1;
+        assert.strictEqual(curve.xeddsaVerify(LIBSIGNAL_PUBLIC, message, LIBSIGNAL_SIGNATURE), false);
+    });
+});
+
+describe('small-order peer keys', () => {
+    // The eight small-order points on Curve25519 share four u values: 0 (the
+    // identity, by convention, and the order 2 point), 1 (the two order 4
+    // points) and the two order 8 values.  Add p - 1, a small-order point on
+    // the twist, and the non-canonical encodings p (= 0) and p + 1 (= 1).  That
+    // gives the usual list of inputs that force an all-zero X25519 output.
+    const SMALL_ORDER = {
+        'u = 0': '0000000000000000000000000000000000000000000000000000000000000000',
+        'u = 1': '0100000000000000000000000000000000000000000000000000000000000000',
+        'order 8, first': 'e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800',
+        'order 8, second': '5f9c95bca3508c24b1d0b1559c83ef5b04445cc4581c8e86d8224eddd09f1157',
+        'u = p - 1': 'ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f',
+        'u = p': 'edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f',
+        'u = p + 1': 'eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f'
+    };
+    const keyPair = curve.generateKeyPair();
+    const withPrefix = u => Buffer.concat([Buffer.from([5]), hex(u)]);
+    // X25519 ignores bit 255, so setting it must not get a point past the check.
+    const highBit = u => {
+        const key = hex(u);
+        key[31] |= 0x80;
+        return key.toString('hex');
+    };
+    const isInvalidSecret = e => e instanceof errors.CurveError &&
+        e.code === errors.ErrorCode.INVALID_SHARED_SECRET;
+
+    for (const [name, u] of Object.entries(SMALL_ORDER)) {
+        it(`calculateAgreement rejects ${name}`, () => {
+            assert.throws(() => curve.calculateAgreement(withPrefix(u), keyPair.privKey),
+                          isInvalidSecret);
+        });
+
+        it(`calculateAgreement rejects ${name} with bit 255 set`, () => {
+            assert.throws(() => curve.calculateAgreement(withPrefix(highBit(u)), keyPair.privKey),
+                          isInvalidSecret);
+        });
+    }
+
+    it('calculateAgreementBatch names the small-order key', () => {
+        const other = curve.generateKeyPair().pubKey;
+        assert.throws(() => curve.calculateAgreementBatch([other, withPrefix(SMALL_ORDER['u = 1'])],
+                                                          keyPair.privKey),
+                      e => isInvalidSecret(e) && /index 1/.test(e.message));
+    });
+
+    it('accepts an ordinary peer key', () => {
+        const other = curve.generateKeyPair();
+        assert.deepStrictEqual(curve.calculateAgreement(other.pubKey, keyPair.privKey),
+                               curve.calculateAgreement(keyPair.pubKey, other.privKey));
+    });
+});
+
+describe('calculateAgreementBatch', () => {
+    const keyPair = curve.generateKeyPair();
+    const peers = [curve.generateKeyPair(), curve.generateKeyPair(), curve.generateKeyPair()];
+    const expected = peers.map(peer => curve.calculateAgreement(peer.pubKey, keyPair.privKey));
+
+    it('returns one secret per key, in order', () => {
+        assert.deepStrictEqual(curve.calculateAgreementBatch(peers.map(x => x.pubKey),
+                                                             keyPair.privKey), expected);
+    });
+
+    it('accepts typed arrays like calculateAgreement', () => {
+        const pubKeys = peers.map(x => new Uint8Array(x.pubKey));
+        const privKey = new Uint8Array(keyPair.privKey);
+        assert.deepStrictEqual(curve.calculateAgreementBatch(pubKeys, privKey), expected);
+        assert.deepStrictEqual(curve.calculateAgreementBatch(pubKeys, keyPair.privKey), expected);
+        assert.deepStrictEqual(curve.calculateAgreementBatch(peers.map(x => x.pubKey), privKey),
+                               expected);
+    });
+
+    it('respects the bounds of typed array views and accepts ArrayBuffers', () => {
+        const backing = new Uint8Array(40);
+        backing.set(peers[0].pubKey, 3);
+        const view = backing.subarray(3, 36);
+        const arrayBuffer = new Uint8Array(peers[1].pubKey).buffer;
+        assert.deepStrictEqual(curve.calculateAgreementBatch([view, arrayBuffer], keyPair.privKey),
+                               expected.slice(0, 2));
+    });
+
+    it('names the index of a malformed key', () => {
+        assert.throws(() => curve.calculateAgreementBatch([peers[0].pubKey, 'key'], keyPair.privKey),
+                      e => e instanceof errors.CurveError &&
+                          e.code === errors.ErrorCode.INVALID_PUBLIC_KEY && /index 1/.test(e.message));
+        assert.throws(() => curve.calculateAgreementBatch([new Uint8Array(32)], keyPair.privKey),
+                      e => e instanceof errors.CurveError && /index 0/.test(e.message));
+    });
+});
+
+describe('montgomeryFromEdwards', () => {
+    const le = n => curveMath.bigIntToBytes(n);
+
+    it('maps the base point y = 4/5 to u = 9', () => {
+        const y = hex('58' + '66'.repeat(31));
+        assert.deepStrictEqual(y, le(curveMath.mod(4n * curveMath.modInverse(5n))));
+        assert.deepStrictEqual(curveMath.montgomeryFromEdwards(y), le(9n));
+    });
+
+    it('maps y = 0 to u = 1 and y = -1 to u = 0', () => {
+        assert.deepStrictEqual(curveMath.montgomeryFromEdwards(le(0n)), le(1n));
+        assert.deepStrictEqual(curveMath.montgomeryFromEdwards(le(curveMath.P - 1n)), le(0n));
+    });
+
+    it('ignores the sign bit of x', () => {
+        const y = hex('58' + '66'.repeat(30) + 'e6');
+        assert.deepStrictEqual(curveMath.montgomeryFromEdwards(y), le(9n));
+    });
+
+    it('rejects y = 1, which has no Montgomery image', () => {
+        assert.throws(() => curveMath.montgomeryFromEdwards(le(1n)), /no Montgomery image/);
+        const signed = le(1n);
+        signed[31] |= 0x80;
+        assert.throws(() => curveMath.montgomeryFromEdwards(signed), /no Montgomery image/);
+    });
+
+    it('rejects non-canonical y and malformed input', () => {
+        assert.throws(() => curveMath.montgomeryFromEdwards(le(curveMath.P)), /Non-canonical/);
+        assert.throws(() => curveMath.montgomeryFromEdwards(le(curveMath.P + 1n)), /Non-canonical/);
+        assert.throws(() => curveMath.montgomeryFromEdwards(Buffer.alloc(31)), TypeError);
+        assert.throws(() => curveMath.montgomeryFromEdwards(new Uint8Array(32)), TypeError);
+    });
+});
+
+describe('Ed25519 key conversion', () => {
+    const ED25519_PKCS8_PREFIX = hex('302e020100300506032b657004220420');
+    const X25519_PKCS8_PREFIX = hex('302e020100300506032b656e04220420');
+    const X25519_SPKI_PREFIX = hex('302a300506032b656e032100');
+
+    function ed25519KeyPair() {
+        const seed = nodeCrypto.randomBytes(32);
+        const privateKey = nodeCrypto.createPrivateKey({
+            key: Buffer.concat([ED25519_PKCS8_PREFIX, seed]),
+            format: 'der',
+            type: 'pkcs8'
+        });
+        const spki = nodeCrypto.createPublicKey(privateKey).export({format: 'der', type: 'spki'});
+        return {seed, edPubKey: spki.subarray(-32)};
+    }
+
+    // RFC 8032 section 7.1, test 1.  The u coordinate is (1 + y) / (1 - y) of
+    // the public key and also the X25519 public key of the clamped first half
+    // of SHA-512(seed).
+    const RFC8032_SEED = hex('9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60');
+    const RFC8032_PUBLIC = hex('d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a');
+    const RFC8032_X25519 = hex('d85e07ec22b0ad881537c2f44d662d1a143cf830c57aca4305d85c7a90f6b62e');
+
+    it('converts the RFC 8032 test 1 public key to its X25519 key', () => {
+        assert.deepStrictEqual(curve.convertEd25519PublicKey(RFC8032_PUBLIC), RFC8032_X25519);
+    });
+
+    it('converts the RFC 8032 test 1 seed to a private key for the same X25519 key', () => {
+        const privKey = curve.convertEd25519PrivateKey(RFC8032_SEED);
+        assert.deepStrictEqual(curve.createKeyPair(privKey).pubKey,
+                               Buffer.concat([Buffer.from([5]), RFC8032_X25519]));
+    });
+
+    it('gives a private key whose public key is the converted public key', () => {
+        for (let i = 0; i < 20; i++) {
+            const {seed, edPubKey} = ed25519KeyPair();
+            const privKey = curve.convertEd25519PrivateKey(seed);
+            assert.deepStrictEqual(curve.createKeyPair(privKey).pubKey.subarray(1),
+                                   curve.convertEd25519PublicKey(edPubKey));
+        }
+    });
+
+    it('agrees with a peer from either side', () => {
+        for (let i = 0; i < 20; i++) {
+            const {seed, edPubKey} = ed25519KeyPair();
+            const privKey = curve.convertEd25519PrivateKey(seed);
+            const pubKey = Buffer.concat([Buffer.from([5]), curve.convertEd25519PublicKey(edPubKey)]);
+            const peer = curve.generateKeyPair();
+            assert.deepStrictEqual(curve.calculateAgreement(peer.pubKey, privKey),
+                                   curve.calculateAgreement(pubKey, peer.privKey));
+        }
+    });
+
+    it('agrees with an independent X25519 implementation', () => {
+        const {seed, edPubKey} = ed25519KeyPair();
+        const peer = curve.generateKeyPair();
+        const privateKey = nodeCrypto.createPrivateKey({
+            key: Buffer.concat([X25519_PKCS8_PREFIX, curve.convertEd25519PrivateKey(seed)]),
+            format: 'der',
+            type: 'pkcs8'
+        });
+        const publicKey = nodeCrypto.createPublicKey({
+            key: Buffer.concat([X25519_SPKI_PREFIX, peer.pubKey.subarray(1)]),
+            format: 'der',
+            type: 'spki'
+        });
+        const pubKey = Buffer.concat([Buffer.from([5]), curve.convertEd25519PublicKey(edPubKey)]);
+        assert.deepStrictEqual(nodeCrypto.diffieHellman({privateKey, publicKey}),
+                               curve.calculateAgreement(pubKey, peer.privKey));
+    });
+});
+
+describe('isContributoryAgreement', () => {
+    const keyPair = curve.generateKeyPair();
+
+    it('is true for an ordinary peer key', () => {
+        for (let i = 0; i < 10; i++) {
+            assert.strictEqual(curve.isContributoryAgreement(curve.generateKeyPair().pubKey,
+                                                             keyPair.privKey), true);
+        }
+    });
+
+    it('is false for every small-order peer key instead of throwing', () => {
+        for (const u of ['00'.repeat(32), '01' + '00'.repeat(31),
+                         'e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800',
+                         '5f9c95bca3508c24b1d0b1559c83ef5b04445cc4581c8e86d8224eddd09f1157',
+                         'ec' + 'ff'.repeat(30) + '7f', 'ed' + 'ff'.repeat(30) + '7f',
+                         'ee' + 'ff'.repeat(30) + '7f']) {
+            const pubKey = Buffer.concat([Buffer.from([5]), hex(u)]);
+            assert.strictEqual(curve.isContributoryAgreement(pubKey, keyPair.privKey), false);
+        }
+    });
+
+    it('still throws on malformed keys', () => {
+        assert.throws(() => curve.isContributoryAgreement(Buffer.alloc(33), keyPair.privKey),
+                      errors.CurveError);
+        assert.throws(() => curve.isContributoryAgreement(keyPair.pubKey, Buffer.alloc(31)),
+                      errors.CurveError);
+    });
+});
+
+describe('malformed arguments', () => {
+    const keyPair = curve.generateKeyPair();
+    const message = Buffer.from('message');
+    const signature = curve.calculateSignature(keyPair.privKey, message);
+    const malformed = [undefined, null, 5, 'abc', {}, [1, 2, 3], true];
+
+    // Each entry builds the argument list with the malformed value at one
+    // position and well formed values everywhere else.
+    const entryPoints = {
+        createKeyPair: [x => [x]],
+        calculateAgreement: [x => [x, keyPair.privKey], x => [keyPair.pubKey, x]],
+        calculateAgreementBatch: [x => [x, keyPair.privKey], x => [[x], keyPair.privKey],
+                                  x => [[keyPair.pubKey], x]],
+        isContributoryAgreement: [x => [x, keyPair.privKey], x => [keyPair.pubKey, x]],
+        calculateSignature: [x => [x, message], x => [keyPair.privKey, x]],
+        xeddsaSign: [x => [x, message], x => [keyPair.privKey, x]],
+        xeddsaVerify: [x => [x, message, signature], x => [keyPair.pubKey, x, signature],
+                       x => [keyPair.pubKey, message, x]],
+        verifySignature: [x => [x, message, signature], x => [keyPair.pubKey, x, signature],
+                          x => [keyPair.pubKey, message, x]]
+    };
+
+    for (const [name, positions] of Object.entries(entryPoints)) {
+        positions.forEach((args, position) => {
+            it(`${name} throws for a malformed argument ${position}`, () => {
+                for (const value of malformed) {
+                    assert.throws(() => curve[name](...args(value)),
+                                  e => e instanceof errors.CurveError || e instanceof TypeError,
+                                  `${name} accepted ${JSON.stringify(value)}`);
+                }
+            });
+        });
+    }
+
+    it('xeddsaSign rejects a random that is not 64 bytes', () => {
+        for (const random of [null, 5, 'abc', {}, Buffer.alloc(0), Buffer.alloc(63),
+                              Buffer.alloc(65), new Uint8Array(63)]) {
+            assert.throws(() => curve.xeddsaSign(keyPair.privKey, message, random), e =>
+                e instanceof errors.CurveError && e.code === errors.ErrorCode.INVALID_RANDOM);
+        }
+    });
+
+    it('native functions reject buffers of the wrong length', () => {
+        const key = Buffer.alloc(32, 1);
+        const random = Buffer.alloc(64);
+        for (const call of [
+            () => native.curve25519_donna(Buffer.alloc(31), key),
+            () => native.curve25519_donna(key, Buffer.alloc(0)),
+            () => native.curve25519_sign(Buffer.alloc(31), message),
+            () => native.curve25519_sign(Buffer.alloc(0), message),
+            () => native.curve25519_verify(signature.subarray(0, 63), key, message),
+            () => native.curve25519_verify(signature, Buffer.alloc(31), message),
+            () => native.xeddsa_sign(Buffer.alloc(31), message, random),
+            () => native.xeddsa_sign(key, message, random.subarray(0, 63))
+        ]) {
+            assert.throws(call, TypeError);
+        }
+    });
+
+    it('native functions reject non-buffer arguments', () => {
+        const key = Buffer.alloc(32, 1);
+        for (const value of malformed) {
+            assert.throws(() => native.curve25519_donna(value, key), TypeError);
+            assert.throws(() => native.curve25519_sign(key, value), TypeError);
+            assert.throws(() => native.curve25519_verify(signature, key, value), TypeError);
+            assert.throws(() => native.xeddsa_sign(key, value, Buffer.alloc(64)), TypeError);
+        }
+    });
+});
+
+describe('argument count', () => {
+    const keyPair = curve.generateKeyPair();
+    const peer = curve.generateKeyPair();
+    const message = Buffer.from('message');
+    const random = Buffer.alloc(64, 7);
+    const signature = curve.xeddsaSign(keyPair.privKey, message, random);
+
+    const entryPoints = {
+        createKeyPair: [keyPair.privKey],
+        calculateAgreement: [peer.pubKey, keyPair.privKey],
+        calculateAgreementBatch: [[peer.pubKey], keyPair.privKey],
+        isContributoryAgreement: [peer.pubKey, keyPair.privKey],
+        calculateSignature: [keyPair.privKey, message],
+        xeddsaSign: [keyPair.privKey, message, random],
+        xeddsaVerify: [keyPair.pubKey, message, signature],
+        verifySignature: [keyPair.pubKey, message, signature]
+    };
+
+    for (const [name, args] of Object.entries(entryPoints)) {
+        // xeddsaSign's random is optional, so only dropping the message counts.
+        const required = name === 'xeddsaSign' ? 2 : args.length;
+
+        it(`${name} throws with too few arguments`, () => {
+            for (let n = 0; n < required; n++) {
+                assert.throws(() => curve[name](...args.slice(0, n)),
+                              e => e instanceof errors.CurveError || e instanceof TypeError);
+            }
+        });
+
+        it(`${name} ignores extra arguments`, () => {
+            assert.deepStrictEqual(curve[name](...args, Buffer.alloc(32), 'extra'),
+                                   curve[name](...args));
+        });
+    }
+
+    it('native functions name themselves and the expected count', () => {
+        const key = Buffer.alloc(32, 1);
+        const calls = {
+            curve25519_donna: [key, key],
+            curve25519_sign: [key, message],
+            curve25519_verify: [signature, key, message],
+            xeddsa_sign: [key, message, random]
+        };
+        for (const [name, args] of Object.entries(calls)) {
+            const n = args.length;
+            for (const count of [0, n - 1, n + 1]) {
+                const given = [...args, key].slice(0, count);
+                assert.throws(() => native[name](...given), {
+                    name: 'TypeError',
+                    message: `${name} expects ${n} arguments, got ${count}`
+                });
+            }
+        }
+    });
+});
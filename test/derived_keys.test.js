@@ -0,0 +1,44 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const derivedKeys = require('../src/derived_keys');
+const {describe, it} = require('node:test');
+
+const hex = x => Buffer.from(x, 'hex');
+
+
+describe('deriveSessionNoncePrefix', () => {
+    it('matches HKDF-SHA256 of the root key', () => {
+        // First 4 bytes of HKDF(rootKey = 00..1f, salt = 0 * 32, info = "WhisperNoncePrefix").
+        const rootKey = Buffer.from(Array.from({length: 32}, (_, i) => i));
+        assert.deepStrictEqual(derivedKeys.deriveSessionNoncePrefix(rootKey), hex('cf7104ec'));
+    });
+
+    it('differs between root keys', () => {
+        assert.notDeepStrictEqual(derivedKeys.deriveSessionNoncePrefix(Buffer.alloc(32, 1)),
+                                  derivedKeys.deriveSessionNoncePrefix(Buffer.alloc(32, 2)));
+    });
+});
+
+describe('deriveNonce', () => {
+    const prefix = hex('cf7104ec');
+
+    it('is prefix || uint64 BE counter', () => {
+        assert.deepStrictEqual(derivedKeys.deriveNonce(prefix, 0), hex('cf7104ec0000000000000000'));
+        assert.deepStrictEqual(derivedKeys.deriveNonce(prefix, 1), hex('cf7104ec0000000000000001'));
+        assert.deepStrictEqual(derivedKeys.deriveNonce(prefix, 0x0102030405),
+                               hex('cf7104ec0000000102030405'));
+        assert.deepStrictEqual(derivedKeys.deriveNonce(prefix, Number.MAX_SAFE_INTEGER),
+                               hex('cf7104ec001fffffffffffff'));
+    });
+
+    it('rejects invalid counters and prefixes', () => {
+        for (const counter of [-1, 1.5, Number.MAX_SAFE_INTEGER + 1, '1', undefined]) {
+            assert.throws(() => derivedKeys.deriveNonce(prefix, counter), RangeError);
+        }
+        assert.throws(() => derivedKeys.deriveNonce(hex('cf7104'), 0));
+        assert.throws(() => derivedKeys.deriveNonce('cf7104ec', 0), TypeError);
+    });
+});
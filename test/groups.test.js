@@ -0,0 +1,35 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const groups = require('../src/groups');
+const {describe, it} = require('node:test');
+
+
+describe('deriveLocalGroupKeys', () => {
+    // Master key 00 01 .. 1f.  The expected keys come from an independent
+    // Python HKDF over the documented "LibSignalGroupKeys" label.
+    const masterKey = Buffer.from(Array.from({length: 32}, (_, i) => i));
+
+    it('matches the known answer', () => {
+        const keys = groups.deriveLocalGroupKeys(masterKey);
+        assert.deepStrictEqual(keys.masterKey, masterKey);
+        assert.strictEqual(keys.groupId.toString('hex'),
+                           '203269728b6096e7b018c3ae1d11b3b3105387c152bb7a466ac2b5ba19a5a14d');
+        assert.strictEqual(keys.accessKey.toString('hex'),
+                           'd97c34a987328dd41d3dcea287ec09091f58ac503e7835eb21257bcd73028e5e');
+        assert.strictEqual(keys.encryptionKey.toString('hex'),
+                           'aa1d2b08491c1a77eb89824a39985037ef2b4e75988c35e662944cd72b15d04b');
+    });
+
+    it('re-derives what createLocalGroupKeys made', () => {
+        const created = groups.createLocalGroupKeys();
+        assert.deepStrictEqual(groups.deriveLocalGroupKeys(created.masterKey), created);
+    });
+
+    it('no longer exports the server-looking names', () => {
+        assert.strictEqual(groups.createGroupKeys, undefined);
+        assert.strictEqual(groups.deriveGroupKeys, undefined);
+    });
+});
@@ -0,0 +1,68 @@
+/* Checks that the signing code wipes its secret buffers.  Built with
+   -DZEROIZE_TEST_HOOK=zeroize_test_record so every zeroize() call reports
+   the buffer it cleared; see test/zeroize.test.js. */
+
+#include <stdio.h>
+#include <string.h>
+#include "curve_sigs.h"
+#include "xeddsa.h"
+
+#define MAX_RECORDS 16
+
+static size_t record_len[MAX_RECORDS];
+static int record_zero[MAX_RECORDS];
+static int records = 0;
+
+void zeroize_test_record(const void* v, size_t n)
+{
+  const unsigned char* p = (const unsigned char*)v;
+  unsigned char acc = 0;
+  size_t i;
+  for (i = 0; i < n; i++)
+    acc |= p[i];
+  if (records < MAX_RECORDS) {
+    record_len[records] = n;
+    record_zero[records] = acc == 0;
+  }
+  records++;
+}
+
+static int expect(const char* name, const size_t* lens, int count)
+{
+  int i, ok = records == count;
+  for (i = 0; ok && i < count; i++)
+    ok = record_len[i] == lens[i] && record_zero[i];
+  printf("%s %s: %d wipes", ok ? "ok" : "FAIL", name, records);
+  for (i = 0; i < records && i < MAX_RECORDS; i++)
+    printf(" %lu%s", (unsigned long)record_len[i], record_zero[i] ? "" : "(dirty)");
+  printf("\n");
+  records = 0;
+  return ok;
+}
+
+int main(void)
+{
+  unsigned char privkey[32], random[64], msg[100], sig[64];
+  int ok = 1;
+
+  memset(privkey, 0x5a, 32);
+  privkey[0] &= 248;
+  privkey[31] &= 127;
+  privkey[31] |= 64;
+  memset(random, 0xa5, 64);
+  memset(msg, 0x42, sizeof(msg));
+
+  {
+    /* crypto_sign_modified's nonce, then curve25519_sign's copy of the key */
+    const size_t lens[] = { 64, 64 };
+    curve25519_sign(sig, privkey, msg, sizeof(msg));
+    ok &= expect("curve25519_sign", lens, 2);
+  }
+  {
+    /* a, -a, the nonce and the working buffer holding a and the random */
+    const size_t lens[] = { 32, 32, 64, sizeof(msg) + 128 };
+    xeddsa_sign(sig, privkey, msg, sizeof(msg), random);
+    ok &= expect("xeddsa_sign", lens, 4);
+  }
+  return ok ? 0 : 1;
+}
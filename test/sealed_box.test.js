@@ -0,0 +1,35 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const curve = require('../src/curve');
+const sealedBox = require('../src/sealed_box');
+const {describe, it} = require('node:test');
+
+
+describe('sealManyToPublicKey', () => {
+    const recipient = curve.generateKeyPair();
+    const plaintexts = ['one', 'two', 'three'].map(x => Buffer.from(x));
+
+    it('seals every payload so it opens', () => {
+        const sealed = sealedBox.sealManyToPublicKey(recipient.pubKey, plaintexts);
+        assert.strictEqual(sealed.length, plaintexts.length);
+        sealed.forEach(({ephemeralPubKey, ciphertext}, i) => {
+            assert.deepStrictEqual(sealedBox.openFromPublicKey(recipient.privKey, ephemeralPubKey,
+                                                               ciphertext), plaintexts[i]);
+        });
+    });
+
+    it('uses a distinct ephemeral key per payload', () => {
+        const sealed = sealedBox.sealManyToPublicKey(recipient.pubKey, plaintexts);
+        const ephemerals = new Set(sealed.map(x => x.ephemeralPubKey.toString('hex')));
+        assert.strictEqual(ephemerals.size, plaintexts.length);
+    });
+
+    it('rejects the batch on a bad payload', () => {
+        assert.throws(() => sealedBox.sealManyToPublicKey(recipient.pubKey,
+                                                          [plaintexts[0], 'two']),
+                      /Expected Buffer at index 1/);
+    });
+});
@@ -0,0 +1,76 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const nodeCrypto = require('crypto');
+const senderKey = require('../src/sender_key');
+const {describe, it} = require('node:test');
+
+
+// Chain seed 00 01 .. 1f.  No published libsignal vectors cover sender key
+// chains, so the expected values come from a separate Python port of
+// libsignal-protocol-java's SenderChainKey and SenderMessageKey:
+// HMAC-SHA256 with seeds 0x01 and 0x02, then HKDFv3 over "WhisperGroup".
+const SEED = Buffer.from(Array.from({length: 32}, (_, i) => i));
+const VECTORS = [
+    {
+        iteration: 0,
+        chainKey: '000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f',
+        iv: 'ed1f5e26325b1399f6a34c76e47ff047',
+        cipherKey: 'd89f10a08215e845ceb4df3fc59c052ad09e01cd499650025ff83df48ed656e6'
+    },
+    {
+        iteration: 1,
+        chainKey: '4304c22c84a53755ab08ead8d97a8d429be5efa480682d7ad1da27f73e1fbe1d',
+        iv: '574f6661ef5e42e6d75902e5d361e82e',
+        cipherKey: '884e6819a3409f789eab3bf21b662b9263d03c62709a800906823961bd3dcb22'
+    },
+    {
+        iteration: 5,
+        chainKey: '6794c7d1dd90f0824a17ba67ae22d30ffb6c6e980bdfe2701b840523eab88810',
+        iv: '6bbb64b6d15610cc65543c1672425698',
+        cipherKey: 'aa6e712115d66cf6de41ab5fbbe6d1dc72ee8c3e3966206d82fc9f11d1a5e43e'
+    },
+    {
+        iteration: 100,
+        chainKey: '7f5a3b78241105de6a04cffa9c6acbbc3a58d31b4c370f373cedb0e5f69ac07b',
+        iv: '99c186c01b1438d7cc5674c2b8d44896',
+        cipherKey: '7f50b8c60f90167a8797e2067bc637ecd30162f0b6bc347f69bf09554f7a2086'
+    }
+];
+
+
+describe('sender key chain', () => {
+    for (const v of VECTORS) {
+        it(`matches the reference at iteration ${v.iteration}`, () => {
+            const chainKey = senderKey.senderChainKeyFromSeed(SEED, v.iteration);
+            assert.strictEqual(chainKey.toString('hex'), v.chainKey);
+            const {messageKey} = senderKey.deriveSenderMessageKey(chainKey);
+            assert.strictEqual(messageKey.iv.toString('hex'), v.iv);
+            assert.strictEqual(messageKey.cipherKey.toString('hex'), v.cipherKey);
+        });
+    }
+
+    it('steps forward to the same keys as jumping from the seed', () => {
+        let chainKey = SEED;
+        for (let i = 0; i < 100; i++) {
+            chainKey = senderKey.deriveSenderMessageKey(chainKey).nextChainKey;
+        }
+        assert.strictEqual(chainKey.toString('hex'), VECTORS[3].chainKey);
+    });
+
+    it('gives two members at the same iteration the same message key', () => {
+        const seed = nodeCrypto.randomBytes(32);
+        const alice = senderKey.deriveSenderMessageKey(senderKey.senderChainKeyFromSeed(seed, 42));
+        const bob = senderKey.deriveSenderMessageKey(senderKey.senderChainKeyFromSeed(
+            Buffer.from(seed), 42));
+        assert.deepStrictEqual(alice, bob);
+    });
+
+    it('rejects iterations outside the supported window', () => {
+        for (const iteration of [-1, 1.5, senderKey.MAX_SENDER_KEY_ITERATION + 1]) {
+            assert.throws(() => senderKey.senderChainKeyFromSeed(SEED, iteration), RangeError);
+        }
+    });
+});
@@ -0,0 +1,85 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const errors = require('../src/errors');
+const keyhelper = require('../src/keyhelper');
+const ProtocolAddress = require('../src/protocol_address');
+const SessionBuilder = require('../src/session_builder');
+const {describe, it} = require('node:test');
+
+
+class MemoryStore {
+    constructor() {
+        this.identityKeyPair = keyhelper.generateIdentityKeyPair();
+        this.registrationId = keyhelper.generateRegistrationId();
+        this.sessions = new Map();
+    }
+
+    async getOurIdentity() {
+        return this.identityKeyPair;
+    }
+
+    async getOurRegistrationId() {
+        return this.registrationId;
+    }
+
+    async isTrustedIdentity() {
+        return true;
+    }
+
+    async loadSession(addr) {
+        return this.sessions.get(addr);
+    }
+
+    async storeSession(addr, record) {
+        this.sessions.set(addr, record);
+    }
+}
+
+
+function makeBundle() {
+    const identityKeyPair = keyhelper.generateIdentityKeyPair();
+    const preKey = keyhelper.generatePreKey(1);
+    const signedPreKey = keyhelper.generateSignedPreKey(identityKeyPair, 1);
+    return {
+        identityKey: identityKeyPair.pubKey,
+        registrationId: keyhelper.generateRegistrationId(),
+        preKey: {keyId: 1, publicKey: preKey.keyPair.pubKey},
+        signedPreKey: {
+            keyId: 1,
+            publicKey: signedPreKey.keyPair.pubKey,
+            signature: signedPreKey.signature
+        }
+    };
+}
+
+
+describe('SessionBuilder.initOutgoing', () => {
+    const addr = new ProtocolAddress('bob', 1);
+
+    it('opens a session for a correctly signed bundle', async () => {
+        const store = new MemoryStore();
+        await new SessionBuilder(store, addr).initOutgoing(makeBundle());
+        assert.ok(store.sessions.get(addr.toString()).haveOpenSession());
+    });
+
+    it('rejects a bundle whose signed prekey signature does not verify', async () => {
+        const store = new MemoryStore();
+        const bundle = makeBundle();
+        bundle.signedPreKey.signature = Buffer.from(bundle.signedPreKey.signature);
+        bundle.signedPreKey.signature[0] ^= 1;
+        await assert.rejects(new SessionBuilder(store, addr).initOutgoing(bundle),
+                             errors.SignatureError);
+        assert.strictEqual(store.sessions.size, 0);
+    });
+
+    it('rejects a signed prekey signed by another identity', async () => {
+        const store = new MemoryStore();
+        const bundle = makeBundle();
+        bundle.identityKey = keyhelper.generateIdentityKeyPair().pubKey;
+        await assert.rejects(new SessionBuilder(store, addr).initOutgoing(bundle),
+                             errors.SignatureError);
+    });
+});
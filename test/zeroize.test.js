@@ -0,0 +1,90 @@
+// vim: ts=4:sw=4:expandtab
+
+'use strict';
+
+const assert = require('assert');
+const childProcess = require('child_process');
+const curve25519 = require('../src/curve25519_wrapper');
+const fs = require('fs');
+const native = require('../build/Release/signal_crypto');
+const os = require('os');
+const path = require('path');
+const {describe, it} = require('node:test');
+
+const root = path.join(__dirname, '..');
+
+
+// Builds test/native/zeroize_test.c against the C sources and defines from
+// binding.gyp.  Returns null when there is no C compiler.
+function buildNativeTest() {
+    const target = JSON.parse(fs.readFileSync(path.join(root, 'binding.gyp'))).targets[0];
+    const sources = target.sources.filter(x => x.endsWith('.c')).map(x => path.join(root, x));
+    const includes = target.include_dirs.filter(x => !x.startsWith('<!'))
+        .map(x => '-I' + path.join(root, x));
+    const defines = target.defines.filter(x => x.startsWith('SPH_')).map(x => '-D' + x);
+    const out = path.join(fs.mkdtempSync(path.join(os.tmpdir(), 'zeroize-')), 'zeroize_test');
+    const cc = process.env.CC || 'cc';
+    const result = childProcess.spawnSync(cc, [
+        '-O2', '-DZEROIZE_TEST_HOOK=zeroize_test_record', ...includes,
+        '-I' + path.join(root, 'native/ed25519/additions'), ...defines,
+        '-o', out, path.join(__dirname, 'native/zeroize_test.c'), ...sources
+    ], {encoding: 'utf8'});
+    if (result.error && result.error.code === 'ENOENT') {
+        return null;
+    }
+    assert.strictEqual(result.status, 0, result.stderr);
+    return out;
+}
+
+
+describe('native secret wiping', () => {
+    it('clears the key copies, nonces and working buffers when signing', t => {
+        const binary = buildNativeTest();
+        if (!binary) {
+            t.skip('no C compiler');
+            return;
+        }
+        const result = childProcess.spawnSync(binary, {encoding: 'utf8'});
+        assert.strictEqual(result.status, 0, result.stdout + result.stderr);
+    });
+});
+
+
+describe('wrapper secret wiping', () => {
+    // Captures the private key copy the wrapper hands to the native code.
+    function captureKey(name, fn) {
+        const original = native[name];
+        let captured;
+        native[name] = (priv, ...rest) => {
+            captured = priv;
+            assert.ok(priv.some(x => x !== 0));
+            return original(priv, ...rest);
+        };
+        try {
+            fn();
+        } finally {
+            native[name] = original;
+        }
+        return captured;
+    }
+
+    const privKey = Buffer.alloc(32, 0x5a);
+    const pubKey = Buffer.from(curve25519.keyPair(Buffer.alloc(32, 0x33)).pubKey);
+    const message = Buffer.from('message');
+
+    const cases = [
+        ['sharedSecret', 'curve25519_donna', () => curve25519.sharedSecret(pubKey, privKey)],
+        ['sign', 'curve25519_sign', () => curve25519.sign(privKey, message)],
+        ['xeddsaSign', 'xeddsa_sign',
+         () => curve25519.xeddsaSign(privKey, message, Buffer.alloc(64, 1))],
+        ['scalarMult', 'curve25519_donna', () => curve25519.scalarMult(privKey, pubKey)]
+    ];
+
+    for (const [name, nativeName, fn] of cases) {
+        it(`${name} wipes its private key copy and leaves the caller's key alone`, () => {
+            const copy = captureKey(nativeName, fn);
+            assert.ok(copy.every(x => x === 0));
+            assert.deepStrictEqual(privKey, Buffer.alloc(32, 0x5a));
+        });
+    }
+});